@@ -14,9 +14,13 @@ import (
 type Channels struct {
 	list               *termui.List
 	channelIDs         map[string]int
+	clientIDs          map[string]string
 	selectedListItemID int // index of which channel is selected from the list
 	offset             int // from what offset are channels rendered
 	cursorPosition     int // the y position of the 'cursor'
+	channels           service.Channels
+	visits             map[string]int // order of the last visit by channel ID
+	visitCount         int
 }
 
 // CreateChannels is the constructor for the Channels component
@@ -24,6 +28,8 @@ func CreateChannels(inputHeight int) *Channels {
 	channels := &Channels{
 		list:       termui.NewList(),
 		channelIDs: make(map[string]int),
+		clientIDs:  make(map[string]string),
+		visits:     make(map[string]int),
 	}
 
 	channels.list.BorderLabel = "Channels"
@@ -112,13 +118,146 @@ func (c *Channels) SetY(y int) {
 	c.list.SetY(y)
 }
 
+// SetHeight sets the height of the widget, see View.layout, the list is
+// scrolled to keep the selected channel in sight
+func (c *Channels) SetHeight(h int) {
+	c.list.Height = h
+	c.scrollTo(c.selectedListItemID)
+}
+
 // SetChannels sets the channels available
 func (c *Channels) SetChannels(channels service.Channels) {
 	sort.Sort(channels)
 	for i, channel := range channels {
 		c.list.Items = append(c.list.Items, fmt.Sprintf(" [%s] %s", channel.ClientID, channel.Name))
 		c.channelIDs[channel.ID] = i
+		c.clientIDs[channel.ID] = channel.ClientID
+	}
+	c.channels = channels
+}
+
+// GetChannels returns the channels of all teams, in the order they are
+// listed
+func (c *Channels) GetChannels() service.Channels {
+	return c.channels
+}
+
+// IsUnread returns true when the channel is marked as unread, see
+// MarkAsUnread
+func (c *Channels) IsUnread(channelID string) bool {
+	index, ok := c.channelIDs[channelID]
+	return ok && strings.HasPrefix(c.list.Items[index], "*")
+}
+
+// MarkAsVisited records that the channel has been shown, see GetLastVisit
+func (c *Channels) MarkAsVisited(channelID string) {
+	c.visitCount++
+	c.visits[channelID] = c.visitCount
+}
+
+// GetLastVisit returns when the channel has been shown last, channels
+// visited later have a higher number. Channels that haven't been shown
+// return 0.
+func (c *Channels) GetLastVisit(channelID string) int {
+	return c.visits[channelID]
+}
+
+// SelectChannel moves the cursor to the channel with channelID, the list
+// is scrolled when the channel is out of sight
+func (c *Channels) SelectChannel(channelID string) {
+	index, ok := c.channelIDs[channelID]
+	if !ok {
+		return
+	}
+
+	c.MarkAsRead(c.GetSelectedChannelID())
+	c.SetSelectedItem(index)
+	c.MarkAsRead(channelID)
+	c.scrollTo(index)
+}
+
+// scrollTo moves the cursor to the item at index, the list is scrolled
+// when the item is out of sight
+func (c *Channels) scrollTo(index int) {
+	height := c.list.InnerBounds().Dy()
+	if index < c.offset {
+		c.offset = index
+	} else if index >= c.offset+height {
+		c.offset = index - height + 1
+	}
+	c.cursorPosition = c.list.InnerBounds().Min.Y + index - c.offset
+}
+
+// AddChannel adds a channel that has been joined to the list, the
+// selected channel stays selected
+func (c *Channels) AddChannel(channel service.Channel) {
+	if _, ok := c.channelIDs[channel.ID]; ok {
+		return
+	}
+
+	channels := append(service.Channels{}, c.channels...)
+	c.resetChannels(append(channels, channel), c.selectedListItemID)
+}
+
+// RemoveChannel removes a channel that has been left from the list. When
+// it was selected the channel that takes its place is selected.
+func (c *Channels) RemoveChannel(channelID string) {
+	index, ok := c.channelIDs[channelID]
+	if !ok {
+		return
+	}
+
+	var channels service.Channels
+	for _, channel := range c.channels {
+		if channel.ID != channelID {
+			channels = append(channels, channel)
+		}
+	}
+
+	// The channel below the selected channel takes its place, or the
+	// one above when it was the last
+	selected := c.selectedListItemID
+	if selected == index {
+		selected++
+		if selected == len(c.channels) {
+			selected = index - 1
+		}
+	}
+	c.resetChannels(channels, selected)
+}
+
+// resetChannels replaces the channels of the list, selected is the index
+// in the current list of the channel to select afterwards. Channels keep
+// their unread mark.
+func (c *Channels) resetChannels(channels service.Channels, selected int) {
+	var selectedID string
+	unread := make(map[string]bool)
+	for id, index := range c.channelIDs {
+		if index == selected {
+			selectedID = id
+		}
+		unread[id] = c.IsUnread(id)
+	}
+
+	c.list.Items = nil
+	c.channelIDs = make(map[string]int)
+	c.clientIDs = make(map[string]string)
+	c.SetChannels(channels)
+	if len(channels) == 0 {
+		c.SetSelectedItem(0)
+		return
+	}
+
+	for id, index := range c.channelIDs {
+		if unread[id] {
+			c.list.Items[index] = fmt.Sprintf("*%s", strings.TrimSpace(c.list.Items[index]))
+		}
 	}
+
+	index := c.channelIDs[selectedID]
+	c.SetSelectedItem(index)
+	c.MarkAsRead(selectedID)
+	c.scrollTo(index)
 }
 
 // SetSelectedItem sets the selectedListItemID given the index
@@ -139,6 +278,12 @@ func (c *Channels) GetSelectedChannelID() string {
 	return result
 }
 
+// GetSelectedClientID returns the ClientID of the team of the channel
+// currently in front
+func (c *Channels) GetSelectedClientID() string {
+	return c.clientIDs[c.GetSelectedChannelID()]
+}
+
 // MoveCursorUp will decrease the selectedListItemID by 1
 func (c *Channels) MoveCursorUp() {
 	if c.selectedListItemID > 0 {
@@ -206,6 +351,10 @@ func (c *Channels) ScrollDown() {
 // MarkAsUnread will be called when a new message arrives and will
 // render an asterisk in front of the channel name
 func (c *Channels) MarkAsUnread(channelID string) {
+	if _, ok := c.channelIDs[channelID]; !ok {
+		return
+	}
+
 	if !strings.Contains(c.list.Items[c.channelIDs[channelID]], "*") {
 		// The order of svc.Channels relates to the order of
 		// list.Items, index will be the index of the channel
@@ -3,25 +3,83 @@ package components
 import (
 	"fmt"
 	"html"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"unicode"
 
 	"github.com/gizak/termui"
 
 	"github.com/jvalduvieco/slack-term/config"
+	"github.com/jvalduvieco/slack-term/service"
 )
 
-// Chat is the definition of a Chat component
+// loadingMarker is shown on top of the messages while older messages are
+// being fetched
+const loadingMarker = "[-- loading older messages --](fg-yellow)"
+
+// maxPreviewLines is the number of lines of a file that are previewed,
+// see Chat.SetFilePreview
+const maxPreviewLines = 10
+
+// codeFgColor and codeBgColor are the colors of code in messages
+const (
+	codeFgColor = termui.ColorYellow
+	codeBgColor = termui.ColorBlack
+)
+
+// selfMentionFgColor and selfMentionBgColor are the colors of mentions of
+// the current user
+const (
+	selfMentionFgColor = termui.ColorBlack | termui.AttrBold
+	selfMentionBgColor = termui.ColorYellow
+)
+
+// emojiRegexp matches emoji shortcodes, e.g. :smile: or
+// :thumbsup::skin-tone-2:
+var emojiRegexp = regexp.MustCompile(`:([a-z0-9_+'-]+)(?:::skin-tone-[2-6])?:`)
+
+// line is a line of cells within the bounds of the Chat pane
+type line struct {
+	cells   []termui.Cell
+	message int // index of the message the line belongs to, -1 for help
+}
+
+// Chat is the definition of a Chat component. Every exported method takes
+// mu, so it can be changed and drawn from any goroutine.
 type Chat struct {
-	list   *termui.List
-	offset int
+	mu              sync.Mutex
+	list            *termui.List
+	messages        []service.Message
+	index           map[string]int // index of messages by timestamp
+	help            []string       // shown instead of the messages when set
+	selected        int            // index of the highlighted message, -1 when none
+	offset          int
+	loading         bool // whether older messages are being fetched
+	historyComplete bool // whether the oldest message is loaded
+	emoji           map[string]string
+	userID          string
+	previews        map[string]string // contents of the previewed files by ID
+	name            string
+	topic           string
+	errText         string // shown in the label instead of the topic when set
+
+	// The lines are built once and kept until what they show changes,
+	// see buildLines
+	messageLines [][]line // lines of every message, nil when not built
+	lines        []line   // lines of all messages, nil when not built
+	linesWidth   int      // width the lines are built for
 }
 
 // CreateChat is the constructor for the Chat struct
 func CreateChat(inputHeight int, name string, topic string) *Chat {
 	chat := &Chat{
-		list:   termui.NewList(),
-		offset: 0,
+		list:     termui.NewList(),
+		index:    make(map[string]int),
+		selected: -1,
+		offset:   0,
 	}
 
 	chat.list.Height = termui.TermHeight() - inputHeight
@@ -34,43 +92,10 @@ func CreateChat(inputHeight int, name string, topic string) *Chat {
 
 // Buffer implements interface termui.Bufferer
 func (c *Chat) Buffer() termui.Buffer {
-	// Build cells, after every item put a newline
-	cells := termui.DefaultTxBuilder.Build(
-		strings.Join(c.list.Items, "\n"),
-		c.list.ItemFgColor, c.list.ItemBgColor,
-	)
-
-	// We will create an array of Line structs, this allows us
-	// to more easily render the items in a list. We will range
-	// over the cells we've created and create a Line within
-	// the bounds of the Chat pane
-	type Line struct {
-		cells []termui.Cell
-	}
-
-	lines := []Line{}
-	line := Line{}
-
-	x := 0
-	for _, cell := range cells {
-
-		if cell.Ch == '\n' {
-			lines = append(lines, line)
-			line = Line{}
-			x = 0
-			continue
-		}
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-		if x+cell.Width() > c.list.InnerBounds().Dx() {
-			lines = append(lines, line)
-			line = Line{}
-			x = 0
-		}
-
-		line.cells = append(line.cells, cell)
-		x++
-	}
-	lines = append(lines, line)
+	lines := c.buildLines()
 
 	// We will print lines bottom up, it will loop over the lines
 	// backwards and for every line it'll set the cell in that line.
@@ -87,20 +112,32 @@ func (c *Chat) Buffer() termui.Buffer {
 			break
 		}
 
+		// The lines of the highlighted message are shown in
+		// reverse
+		reverse := lines[i].message >= 0 && lines[i].message == c.selected
+
 		x := c.list.InnerBounds().Min.X
 		for _, cell := range lines[i].cells {
+			if reverse {
+				cell.Fg |= termui.AttrReverse
+			}
 			buf.Set(x, currentY, cell)
 			x += cell.Width()
 		}
 
 		// When we're not at the end of the pane, fill it up
-		// with empty characters
+		// with empty characters, the highlighted message is
+		// filled up to the edge
+		fg := c.list.ItemFgColor
+		if reverse {
+			fg |= termui.AttrReverse
+		}
 		for x < c.list.InnerBounds().Max.X {
 			buf.Set(
 				x, currentY,
 				termui.Cell{
 					Ch: ' ',
-					Fg: c.list.ItemFgColor,
+					Fg: fg,
 					Bg: c.list.ItemBgColor,
 				},
 			)
@@ -128,49 +165,826 @@ func (c *Chat) Buffer() termui.Buffer {
 		currentY--
 	}
 
+	// Show the loading marker on top of the messages
+	if c.loading {
+		x := c.list.InnerBounds().Min.X
+		cells := termui.DefaultTxBuilder.Build(
+			loadingMarker, c.list.ItemFgColor, c.list.ItemBgColor)
+		for _, cell := range termui.DTrimTxCls(cells, c.list.InnerWidth()) {
+			buf.Set(x, paneMinY, cell)
+			x += cell.Width()
+		}
+	}
+
 	return buf
 }
 
+// buildLines will create an array of line structs, this allows us to
+// more easily render the items in a list. We will range over the cells
+// of the items and create a line within the bounds of the Chat pane.
+//
+// The lines are kept for the next call, only the lines of messages that
+// have changed since are built again, or all of them when the width of
+// the Chat pane has changed.
+func (c *Chat) buildLines() []line {
+	if width := c.list.InnerBounds().Dx(); width != c.linesWidth {
+		c.linesWidth = width
+		c.invalidateLines()
+	}
+	if c.lines != nil {
+		return c.lines
+	}
+
+	if c.help != nil {
+		c.lines = c.wrapLines(c.buildCells(c.help), nil, -1)
+		return c.lines
+	}
+
+	lines := []line{}
+	for i, message := range c.messages {
+		if c.messageLines[i] == nil {
+			c.messageLines[i] = c.renderMessage(message, i)
+		}
+
+		// Older messages might have been prepended since the lines
+		// were built
+		for _, l := range c.messageLines[i] {
+			l.message = i
+			lines = append(lines, l)
+		}
+	}
+	if len(lines) == 0 {
+		lines = append(lines, line{message: -1})
+	}
+
+	c.lines = lines
+	return lines
+}
+
+// invalidateLines makes buildLines build the lines of all messages again
+func (c *Chat) invalidateLines() {
+	c.messageLines = make([][]line, len(c.messages))
+	c.lines = nil
+}
+
+// invalidateMessage makes buildLines build the lines of the message with
+// index i again
+func (c *Chat) invalidateMessage(i int) {
+	c.messageLines[i] = nil
+	c.lines = nil
+}
+
+// buildCells builds the cells of items, which may contain termui markup,
+// after every item but the last a newline is put
+func (c *Chat) buildCells(items []string) []termui.Cell {
+	return termui.DefaultTxBuilder.Build(
+		strings.Join(items, "\n"),
+		c.list.ItemFgColor, c.list.ItemBgColor,
+	)
+}
+
+// wrapLines wraps the cells of a message into lines within the bounds of
+// the Chat pane, every line starts with prefix
+func (c *Chat) wrapLines(cells []termui.Cell, prefix []termui.Cell, message int) []line {
+	newLine := func() line {
+		current := line{message: message}
+		current.cells = append(current.cells, prefix...)
+		return current
+	}
+
+	width := 0
+	for _, cell := range prefix {
+		width += cell.Width()
+	}
+
+	lines := []line{}
+	current := newLine()
+
+	x := width
+	for _, cell := range cells {
+
+		if cell.Ch == '\n' {
+			lines = append(lines, current)
+			current = newLine()
+			x = width
+			continue
+		}
+
+		if x+cell.Width() > c.list.InnerBounds().Dx() {
+			lines = append(lines, current)
+			current = newLine()
+			x = width
+		}
+
+		// Wide characters, like most emoji, take up two columns
+		current.cells = append(current.cells, cell)
+		x += cell.Width()
+	}
+	lines = append(lines, current)
+
+	return lines
+}
+
+// renderMessage will create the lines of a message that can be rendered
+// in the Chat pane. The blocks or the text, the shared files, the
+// attachments, the reactions and the reply count of the message are
+// rendered below each other:
+//
+//	[23:59] <erroneousboat> Hello world!
+//	[file] build.log (1.2 KB, Plain Text)
+//	▌ Attachment title
+//	▌ Attachment text
+//	  :thumbsup: 3  :tada: 1
+//	  2 replies
+func (c *Chat) renderMessage(message service.Message, index int) []line {
+	if message.Deleted {
+		return c.wrapLines(c.buildCells([]string{
+			fmt.Sprintf(
+				"[%s] <[%s](fg-green)> [(message deleted)](fg-red)",
+				message.Time.Format("15:04"),
+				message.Name,
+			),
+		}), nil, index)
+	}
+
+	cells := c.buildCells([]string{
+		fmt.Sprintf(
+			"[%s] <[%s](fg-green)> ",
+			message.Time.Format("15:04"),
+			message.Name,
+		),
+	})
+
+	// The text of a message with blocks is a fallback for clients that
+	// can't show blocks
+	if len(message.Blocks) == 0 {
+		cells = append(cells, c.renderText(message.Spans())...)
+	}
+
+	if message.Edited {
+		cells = append(cells, c.buildCells([]string{" (edited)"})...)
+	}
+
+	// A file that is shared without a comment is shown next to the name
+	// of the user
+	inline := len(message.Files) > 0 && len(message.Blocks) == 0 && message.Text == ""
+	if inline {
+		cells = append(cells, c.renderFile(message.Files[0])...)
+	}
+
+	lines := c.wrapLines(cells, nil, index)
+
+	for i, file := range message.Files {
+		if i > 0 || !inline {
+			lines = append(lines, c.wrapLines(c.renderFile(file), nil, index)...)
+		}
+		lines = append(lines, c.renderPreview(file, index)...)
+	}
+
+	for _, block := range message.Blocks {
+		lines = append(lines, c.wrapLines(c.renderBlock(block, message.Mentions), nil, index)...)
+	}
+
+	for _, att := range message.Attachments {
+		lines = append(lines, c.renderAttachment(att, message.Mentions, index)...)
+	}
+
+	var footer []string
+	if len(message.Reactions) > 0 {
+		var reactions []string
+		for _, reaction := range message.Reactions {
+			reactions = append(reactions, fmt.Sprintf(
+				"%s %d", formatEmoji(":"+reaction.Name+":", c.emoji), reaction.Count))
+		}
+		footer = append(footer, fmt.Sprintf("  %s", strings.Join(reactions, "  ")))
+	}
+
+	if message.ReplyCount == 1 {
+		footer = append(footer, "[  1 reply](fg-blue)")
+	} else if message.ReplyCount > 1 {
+		footer = append(footer, fmt.Sprintf("[  %d replies](fg-blue)", message.ReplyCount))
+	}
+
+	if len(footer) > 0 {
+		lines = append(lines, c.wrapLines(c.buildCells(footer), nil, index)...)
+	}
+
+	return lines
+}
+
+// renderText creates the cells of the spans of a mrkdwn text, lines that
+// are quoted start with a quote marker
+func (c *Chat) renderText(spans []service.Span) []termui.Cell {
+	var cells []termui.Cell
+
+	quote := true // whether a quote marker may start the next line
+	for _, span := range spans {
+		if quote && span.Style&service.StyleQuote != 0 {
+			cells = append(cells, c.styledCells("│ ", termui.ColorBlue, c.list.ItemBgColor)...)
+		}
+		cells = append(cells, c.renderSpan(span)...)
+		quote = strings.HasSuffix(span.Text, "\n")
+	}
+	return cells
+}
+
+// renderBlockText creates the cells of a text of a block or attachment
+func (c *Chat) renderBlockText(text service.BlockText, mentions map[string]string) []termui.Cell {
+	if text.Mrkdwn {
+		return c.renderText(service.ParseMrkdwn(text.Text, mentions))
+	}
+	return c.renderSpan(service.Span{Text: text.Text})
+}
+
+// renderBlock creates the cells of a Block Kit block:
+//
+//	header       bold text
+//	section      text, followed by a line per field
+//	context      the texts of the elements next to each other
+//	divider      a horizontal line
+//	actions      the labels of the buttons and menus in brackets
+func (c *Chat) renderBlock(block service.Block, mentions map[string]string) []termui.Cell {
+	newline := termui.Cell{Ch: '\n'}
+
+	var cells []termui.Cell
+	switch block.Type {
+	case "header":
+		for _, cell := range c.renderBlockText(block.Text, mentions) {
+			cell.Fg |= termui.AttrBold
+			cells = append(cells, cell)
+		}
+	case "section":
+		cells = c.renderBlockText(block.Text, mentions)
+		for i, field := range block.Fields {
+			if i > 0 || len(cells) > 0 {
+				cells = append(cells, newline)
+			}
+			cells = append(cells, c.renderBlockText(field, mentions)...)
+		}
+	case "context":
+		for i, element := range block.Elements {
+			if i > 0 {
+				cells = append(cells, c.styledCells("  ", c.list.ItemFgColor, c.list.ItemBgColor)...)
+			}
+			cells = append(cells, c.renderBlockText(element, mentions)...)
+		}
+	case "divider":
+		cells = c.styledCells(
+			strings.Repeat("─", c.list.InnerBounds().Dx()), c.list.ItemFgColor, c.list.ItemBgColor)
+	case "actions":
+		for i, element := range block.Elements {
+			if i > 0 {
+				cells = append(cells, c.styledCells(" ", c.list.ItemFgColor, c.list.ItemBgColor)...)
+			}
+			cells = append(cells, c.styledCells("["+element.Text+"]", termui.ColorCyan, c.list.ItemBgColor)...)
+		}
+	}
+	return cells
+}
+
+// renderAttachment creates the lines of an attachment. The pretext is
+// shown above the attachment, the other lines start with a bar in the
+// color of the attachment.
+func (c *Chat) renderAttachment(att service.Attachment, mentions map[string]string, index int) []line {
+	var lines []line
+	if att.Pretext != "" {
+		lines = append(lines, c.wrapLines(
+			c.renderText(service.ParseMrkdwn(att.Pretext, mentions)), nil, index)...)
+	}
+
+	bar := c.styledCells("▌ ", attachmentColor(att.Color, c.list.ItemFgColor), c.list.ItemBgColor)
+
+	var items [][]termui.Cell
+	if att.Title != "" {
+		var title []termui.Cell
+		for _, cell := range c.renderSpan(service.Span{Text: html.UnescapeString(att.Title)}) {
+			cell.Fg |= termui.AttrBold
+			title = append(title, cell)
+		}
+		items = append(items, title)
+	}
+
+	if att.Text != "" {
+		items = append(items, c.renderText(service.ParseMrkdwn(att.Text, mentions)))
+	}
+
+	for _, field := range att.Fields {
+		var title []termui.Cell
+		for _, cell := range c.renderSpan(service.Span{Text: html.UnescapeString(field.Title)}) {
+			cell.Fg |= termui.AttrBold
+			title = append(title, cell)
+		}
+		items = append(items, title, c.renderText(service.ParseMrkdwn(field.Value, mentions)))
+	}
+
+	if att.Footer != "" {
+		items = append(items, c.renderText(service.ParseMrkdwn(att.Footer, mentions)))
+	}
+
+	for _, item := range items {
+		lines = append(lines, c.wrapLines(item, bar, index)...)
+	}
+	return lines
+}
+
+// renderFile creates the cells of a shared file, e.g.
+// [file] build.log (1.2 KB, Plain Text)
+func (c *Chat) renderFile(file service.File) []termui.Cell {
+	fg, bg := c.list.ItemFgColor, c.list.ItemBgColor
+
+	name := file.Name
+	if name == "" {
+		name = file.Title
+	}
+
+	details := formatSize(file.Size)
+	if file.PrettyType != "" {
+		details += ", " + file.PrettyType
+	} else if file.Filetype != "" {
+		details += ", " + file.Filetype
+	}
+
+	cells := c.styledCells("[file] ", termui.ColorCyan, bg)
+	cells = append(cells, c.styledCells(name, fg|termui.AttrBold, bg)...)
+	return append(cells, c.styledCells(" ("+details+")", fg, bg)...)
+}
+
+// renderPreview creates the lines of the preview of a file, when it is
+// previewed. Only the first maxPreviewLines lines of the file are shown.
+func (c *Chat) renderPreview(file service.File, index int) []line {
+	content, ok := c.previews[file.ID]
+	if !ok {
+		return nil
+	}
+
+	// Tabs and other control characters would mess up the terminal
+	content = strings.Replace(content, "\r\n", "\n", -1)
+	content = strings.Replace(content, "\t", "    ", -1)
+	content = strings.Map(func(r rune) rune {
+		if r != '\n' && unicode.IsControl(r) {
+			return '?'
+		}
+		return r
+	}, content)
+
+	rows := strings.Split(strings.TrimRight(content, "\n"), "\n")
+	more := 0
+	if len(rows) > maxPreviewLines {
+		more = len(rows) - maxPreviewLines
+		rows = rows[:maxPreviewLines]
+	}
+
+	bar := c.styledCells("│ ", termui.ColorCyan, c.list.ItemBgColor)
+
+	var lines []line
+	for _, row := range rows {
+		lines = append(lines, c.wrapLines(c.styledCells(row, codeFgColor, codeBgColor), bar, index)...)
+	}
+	if more > 0 {
+		lines = append(lines, c.wrapLines(c.buildCells([]string{
+			fmt.Sprintf("[… %d more lines](fg-cyan)", more),
+		}), bar, index)...)
+	}
+	return lines
+}
+
+// formatSize formats a file size in bytes, e.g. 512 B or 1.2 MB
+func formatSize(size int) string {
+	if size < 1024 {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	units := []string{"KB", "MB", "GB", "TB"}
+	value := float64(size) / 1024
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
+
+// attachmentColors are the terminal colors, indexed by the bits of their
+// red, green and blue components
+var attachmentColors = [8]termui.Attribute{
+	termui.ColorBlack, termui.ColorRed, termui.ColorGreen, termui.ColorYellow,
+	termui.ColorBlue, termui.ColorMagenta, termui.ColorCyan, termui.ColorWhite,
+}
+
+// attachmentColor returns the terminal color of the color of an
+// attachment, which is "good", "warning", "danger" or a hex color code
+// like #36a64f. Hex codes are mapped to the nearest terminal color.
+// Attachments without a color get fallback.
+func attachmentColor(color string, fallback termui.Attribute) termui.Attribute {
+	switch color {
+	case "good":
+		return termui.ColorGreen
+	case "warning":
+		return termui.ColorYellow
+	case "danger":
+		return termui.ColorRed
+	}
+
+	rgb, err := strconv.ParseUint(strings.TrimPrefix(color, "#"), 16, 32)
+	if err != nil || len(strings.TrimPrefix(color, "#")) != 6 {
+		return fallback
+	}
+
+	index := 0
+	if rgb>>16&0xff >= 0x80 {
+		index |= 1
+	}
+	if rgb>>8&0xff >= 0x80 {
+		index |= 2
+	}
+	if rgb&0xff >= 0x80 {
+		index |= 4
+	}
+	return attachmentColors[index]
+}
+
+// renderSpan creates the cells of a span of the text of a message. As a
+// terminal has no italic and strikethrough, italic text is underlined and
+// struck through text is shown in reverse. Code has a distinct background
+// and so do mentions of the current user.
+func (c *Chat) renderSpan(span service.Span) []termui.Cell {
+	fg, bg := c.list.ItemFgColor, c.list.ItemBgColor
+
+	switch {
+	case span.Style&(service.StyleCode|service.StyleCodeBlock) != 0:
+		// Code is shown as is, emoji shortcodes included
+		return c.styledCells(span.Text, codeFgColor, codeBgColor)
+	case span.Style&service.StyleLink != 0:
+		fg = termui.ColorBlue | termui.AttrUnderline
+	case span.Style&service.StyleMention != 0 && (span.ID == c.userID || span.IsBroadcast()):
+		fg, bg = selfMentionFgColor, selfMentionBgColor
+	case span.Style&service.StyleMention != 0:
+		fg = termui.ColorCyan
+	}
+
+	if span.Style&service.StyleBold != 0 {
+		fg |= termui.AttrBold
+	}
+	if span.Style&service.StyleItalic != 0 {
+		fg |= termui.AttrUnderline
+	}
+	if span.Style&service.StyleStrike != 0 {
+		fg |= termui.AttrReverse
+	}
+
+	// Replace the emoji shortcodes, custom emoji are images which can't
+	// be shown in a terminal, they are left as shortcode in a distinct
+	// color
+	var cells []termui.Cell
+	last := 0
+	for _, match := range emojiRegexp.FindAllStringSubmatchIndex(span.Text, -1) {
+		unicode, custom, ok := lookupEmoji(span.Text[match[2]:match[3]], c.emoji)
+		if !ok {
+			continue
+		}
+
+		cells = append(cells, c.styledCells(span.Text[last:match[0]], fg, bg)...)
+		if custom {
+			cells = append(cells, c.styledCells(span.Text[match[0]:match[1]], termui.ColorMagenta, bg)...)
+		} else {
+			cells = append(cells, c.styledCells(unicode, fg, bg)...)
+		}
+		last = match[1]
+	}
+	return append(cells, c.styledCells(span.Text[last:], fg, bg)...)
+}
+
+// styledCells creates a cell for every character of text
+func (c *Chat) styledCells(text string, fg termui.Attribute, bg termui.Attribute) []termui.Cell {
+	var cells []termui.Cell
+	for _, r := range text {
+		cells = append(cells, termui.Cell{Ch: r, Fg: fg, Bg: bg})
+	}
+	return cells
+}
+
+// lookupEmoji returns the unicode of the emoji shortcode name, custom is
+// set for the custom emoji of the team that have no unicode
+func lookupEmoji(name string, emoji map[string]string) (unicode string, custom bool, ok bool) {
+	if unicode, ok := service.LookupEmoji(name); ok {
+		return unicode, false, true
+	}
+
+	unicode, ok = emoji[name]
+	if !ok {
+		return "", false, false
+	}
+	return unicode, unicode == "", true
+}
+
+// formatEmoji replaces the emoji shortcodes in text by their unicode, the
+// custom emoji of the team without unicode are colored in termui markup
+func formatEmoji(text string, emoji map[string]string) string {
+	return emojiRegexp.ReplaceAllStringFunc(text, func(code string) string {
+		unicode, custom, ok := lookupEmoji(emojiRegexp.FindStringSubmatch(code)[1], emoji)
+		if !ok {
+			return code
+		}
+		if custom {
+			return fmt.Sprintf("[%s](fg-magenta)", code)
+		}
+		return unicode
+	})
+}
+
 // GetHeight implements interface termui.GridBufferer
 func (c *Chat) GetHeight() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	return c.list.Block.GetHeight()
 }
 
 // SetWidth implements interface termui.GridBufferer
 func (c *Chat) SetWidth(w int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	c.list.SetWidth(w)
 }
 
 // SetX implements interface termui.GridBufferer
 func (c *Chat) SetX(x int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	c.list.SetX(x)
 }
 
 // SetY implements interface termui.GridBufferer
 func (c *Chat) SetY(y int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	c.list.SetY(y)
 }
 
+// SetHeight sets the height of the widget, see View.layout
+func (c *Chat) SetHeight(h int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.list.Height = h
+}
+
 // GetMaxNumberOfMessagesVisible returns the maximum numner of messages visible within the widget
 func (c *Chat) GetMaxNumberOfMessagesVisible() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.visibleLines()
+}
+
+// visibleLines returns the number of lines that fit in the Chat pane
+func (c *Chat) visibleLines() int {
 	return c.list.InnerBounds().Max.Y - c.list.InnerBounds().Min.Y
 }
 
 // AddMessages adds an array of mesages into the widget
-func (c *Chat) AddMessages(messages []string) {
+func (c *Chat) AddMessages(messages []service.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	for _, message := range messages {
-		c.AddMessage(message)
+		c.addMessage(message)
+	}
+}
+
+// AddMessage adds a single message to the widget, when a message with the
+// same timestamp is already shown it will be replaced
+func (c *Chat) AddMessage(message service.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.addMessage(message)
+}
+
+func (c *Chat) addMessage(message service.Message) {
+	if c.updateMessage(message) {
+		return
+	}
+
+	c.messages = append(c.messages, message)
+	c.index[message.Timestamp] = len(c.messages) - 1
+	c.messageLines = append(c.messageLines, nil)
+	c.lines = nil
+}
+
+// PrependMessages adds an array of older messages in front of the
+// messages in the widget. The scroll position is kept because offset
+// is counted from the newest message.
+func (c *Chat) PrependMessages(messages []service.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.messages = append(append([]service.Message{}, messages...), c.messages...)
+	c.reindex()
+	c.messageLines = append(make([][]line, len(messages)), c.messageLines...)
+	c.lines = nil
+
+	if c.selected >= 0 {
+		c.selected += len(messages)
+	}
+}
+
+// UpdateMessage replaces the message with the same timestamp as message,
+// it returns false when there is no such message in the widget
+func (c *Chat) UpdateMessage(message service.Message) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.updateMessage(message)
+}
+
+func (c *Chat) updateMessage(message service.Message) bool {
+	i, ok := c.index[message.Timestamp]
+	if !ok {
+		return false
+	}
+
+	c.messages[i] = message
+	c.invalidateMessage(i)
+	return true
+}
+
+// DeleteMessage replaces the message with the given timestamp with a
+// placeholder
+func (c *Chat) DeleteMessage(timestamp string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i, ok := c.index[timestamp]
+	if !ok {
+		return
+	}
+
+	c.messages[i].Deleted = true
+	c.invalidateMessage(i)
+}
+
+// AddReaction adds the reaction name of userID to the message with
+// timestamp
+func (c *Chat) AddReaction(timestamp string, name string, userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if i, ok := c.index[timestamp]; ok {
+		c.messages[i].AddReaction(name, userID)
+		c.invalidateMessage(i)
+	}
+}
+
+// RemoveReaction removes the reaction name of userID from the message
+// with timestamp
+func (c *Chat) RemoveReaction(timestamp string, name string, userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if i, ok := c.index[timestamp]; ok {
+		c.messages[i].RemoveReaction(name, userID)
+		c.invalidateMessage(i)
+	}
+}
+
+// GetThreadParent returns the message a thread will be opened on, which
+// is the highlighted message, or when there is none the newest message
+// that has replies or else the newest message. It returns false when
+// there are no messages.
+func (c *Chat) GetThreadParent() (service.Message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.messages) == 0 || c.help != nil {
+		return service.Message{}, false
 	}
+
+	if c.selected >= 0 {
+		return c.messages[c.selected], true
+	}
+
+	for i := len(c.messages) - 1; i >= 0; i-- {
+		if c.messages[i].ReplyCount > 0 && !c.messages[i].Deleted {
+			return c.messages[i], true
+		}
+	}
+	return c.messages[len(c.messages)-1], true
 }
 
-// AddMessage adds a single message to list.Items
-func (c *Chat) AddMessage(message string) {
-	c.list.Items = append(c.list.Items, html.UnescapeString(message))
+// reindex rebuilds the index of messages by timestamp
+func (c *Chat) reindex() {
+	c.index = make(map[string]int)
+	for i, message := range c.messages {
+		c.index[message.Timestamp] = i
+	}
 }
 
-// ClearMessages clear the list.Items
+// ClearMessages clears the messages of the widget
 func (c *Chat) ClearMessages() {
-	c.list.Items = []string{}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.messages = nil
+	c.index = make(map[string]int)
+	c.help = nil
+	c.selected = -1
+	c.offset = 0
+	c.loading = false
+	c.historyComplete = false
+	c.previews = nil
+	c.invalidateLines()
+}
+
+// SetCustomEmoji sets the custom emoji of the team of the messages, see
+// service.Backend.GetCustomEmoji
+func (c *Chat) SetCustomEmoji(emoji map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.emoji = emoji
+	c.invalidateLines()
+}
+
+// SetCurrentUserID sets the ID of the user that is logged in on the team
+// of the messages, mentions of the user are highlighted
+func (c *Chat) SetCurrentUserID(userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.userID = userID
+	c.invalidateLines()
+}
+
+// SetFilePreview shows the content of the shared file with fileID below
+// the file, see renderPreview
+func (c *Chat) SetFilePreview(fileID string, content string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.previews == nil {
+		c.previews = make(map[string]string)
+	}
+	c.previews[fileID] = content
+	c.invalidateLines()
+}
+
+// ClearFilePreview hides the preview of the shared file with fileID
+func (c *Chat) ClearFilePreview(fileID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.previews, fileID)
+	c.invalidateLines()
+}
+
+// HasFilePreview returns true when the preview of the shared file with
+// fileID is shown
+func (c *Chat) HasFilePreview(fileID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.previews[fileID]
+	return ok
+}
+
+// SetLoading will show or hide the marker that indicates older messages
+// are being fetched
+func (c *Chat) SetLoading(loading bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.loading = loading
+}
+
+// SetHistoryComplete marks that there are no older messages to fetch
+func (c *Chat) SetHistoryComplete() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.historyComplete = true
+}
+
+// NeedsOlderMessages returns true when the Chat pane is scrolled to the
+// oldest loaded message and there may be older messages to fetch
+func (c *Chat) NeedsOlderMessages() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return !c.historyComplete && !c.loading && c.offset >= c.maxOffset()
+}
+
+// maxOffset returns the offset at which the oldest line is rendered at
+// the top of the Chat pane
+func (c *Chat) maxOffset() int {
+	maxOffset := len(c.buildLines()) - c.visibleLines()
+	if maxOffset < 0 {
+		return 0
+	}
+	return maxOffset
 }
 
 // ScrollUp will render the chat messages based on the offset of the Chat
@@ -181,11 +995,14 @@ func (c *Chat) ClearMessages() {
 // pane). Increasing the offset will thus result in substracting the offset
 // from the len(Chat.list.Items).
 func (c *Chat) ScrollUp() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	c.offset = c.offset + 10
 
 	// Protect overscrolling
-	if c.offset > len(c.list.Items)-1 {
-		c.offset = len(c.list.Items) - 1
+	if c.offset > c.maxOffset() {
+		c.offset = c.maxOffset()
 	}
 }
 
@@ -197,6 +1014,9 @@ func (c *Chat) ScrollUp() {
 // pane). Increasing the offset will thus result in substracting the offset
 // from the len(Chat.list.Items).
 func (c *Chat) ScrollDown() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	c.offset = c.offset - 10
 
 	// Protect overscrolling
@@ -205,22 +1025,141 @@ func (c *Chat) ScrollDown() {
 	}
 }
 
+// SelectPrevious moves the highlight to the message before the
+// highlighted message, when no message is highlighted the newest message
+// will be. The Chat pane is scrolled to keep the message in view.
+func (c *Chat) SelectPrevious() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.messages) == 0 || c.help != nil {
+		return
+	}
+
+	if c.selected < 0 {
+		c.selected = len(c.messages) - 1
+	} else if c.selected > 0 {
+		c.selected--
+	}
+	c.scrollToSelected()
+}
+
+// SelectNext moves the highlight to the message after the highlighted
+// message, when no message is highlighted the newest message will be
+func (c *Chat) SelectNext() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.messages) == 0 || c.help != nil {
+		return
+	}
+
+	if c.selected < 0 {
+		c.selected = len(c.messages) - 1
+	} else if c.selected < len(c.messages)-1 {
+		c.selected++
+	}
+	c.scrollToSelected()
+}
+
+// ClearSelection removes the highlight
+func (c *Chat) ClearSelection() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.selected = -1
+}
+
+// GetSelectedMessage returns the highlighted message, it returns false
+// when no message is highlighted
+func (c *Chat) GetSelectedMessage() (service.Message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.selected < 0 || c.selected >= len(c.messages) {
+		return service.Message{}, false
+	}
+	return c.messages[c.selected], true
+}
+
+// scrollToSelected sets the offset so the lines of the highlighted message
+// are within the Chat pane
+func (c *Chat) scrollToSelected() {
+	lines := c.buildLines()
+
+	first, last := -1, -1
+	for i, l := range lines {
+		if l.message == c.selected {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	if first < 0 {
+		return
+	}
+
+	// offset is counted from the newest line
+	height := c.visibleLines()
+	bottom := len(lines) - 1 - c.offset
+	top := bottom - height + 1
+
+	if last > bottom {
+		c.offset = len(lines) - 1 - last
+	}
+	if first < top {
+		c.offset = len(lines) - first - height
+	}
+
+	if c.offset > c.maxOffset() {
+		c.offset = c.maxOffset()
+	}
+	if c.offset < 0 {
+		c.offset = 0
+	}
+}
+
 // SetBorderLabel will set Label of the Chat pane to the specified string
 func (c *Chat) SetBorderLabel(name string, topic string) {
-	var channelName string
-	if topic != "" {
-		channelName = fmt.Sprintf("%s - %s",
-			name,
-			topic,
-		)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.name = name
+	c.topic = topic
+	c.setLabel()
+}
+
+// SetError shows the text of an error in the label of the Chat pane, in
+// place of the topic. An empty text shows the topic again.
+func (c *Chat) SetError(text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.errText = text
+	c.setLabel()
+}
+
+// setLabel sets the label of the Chat pane to the channel name, followed
+// by the error or the topic
+func (c *Chat) setLabel() {
+	detail := c.topic
+	if c.errText != "" {
+		detail = c.errText
+	}
+
+	if detail != "" {
+		c.list.BorderLabel = fmt.Sprintf("%s - %s", c.name, detail)
 	} else {
-		channelName = name
+		c.list.BorderLabel = c.name
 	}
-	c.list.BorderLabel = channelName
 }
 
 // ShowHelp shows the usage and key bindings in the chat pane
 func (c *Chat) ShowHelp(cfg *config.Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	help := []string{
 		"slack-term - slack client for your terminal",
 		"",
@@ -247,5 +1186,9 @@ func (c *Chat) ShowHelp(cfg *config.Config) {
 		help = append(help, "")
 	}
 
-	c.list.Items = help
+	c.help = help
+	c.selected = -1
+	c.offset = 0
+	c.historyComplete = true
+	c.lines = nil
 }
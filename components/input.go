@@ -1,22 +1,50 @@
 package components
 
 import (
+	"unicode"
+
 	"github.com/gizak/termui"
 )
 
-// Input is the definition of an Input component
+// undoSize is the number of edits of the input that can be undone
+const undoSize = 100
+
+// Input is the definition of an Input component, the text is wrapped at
+// the width of the Input, which grows up to maxLines lines to show it
 type Input struct {
 	par            *termui.Par
 	text           []rune
 	cursorPosition int
+	maxLines       int
+	offset         int // the first line that is shown
+
+	killed   []rune       // text removed by the last kills, see Yank
+	undo     []inputState // states before the edits, the last is the newest
+	redo     []inputState // states before the undos, the last is the newest
+	lastEdit string       // kind of the last edit, see edit
+}
+
+// inputState is the text and cursor of the input at some point, to undo
+// and redo edits
+type inputState struct {
+	text           []rune
+	cursorPosition int
+}
+
+// inputLine is a line of the Input as it is shown, the text between start
+// and end
+type inputLine struct {
+	start int
+	end   int
 }
 
 // CreateInput is the constructor of the Input struct
-func CreateInput() *Input {
+func CreateInput(maxLines int) *Input {
 	input := &Input{
 		par:            termui.NewPar(""),
 		text:           make([]rune, 0),
 		cursorPosition: 0,
+		maxLines:       maxLines,
 	}
 
 	input.par.Height = 3
@@ -26,13 +54,65 @@ func CreateInput() *Input {
 
 // Buffer implements interface termui.Bufferer
 func (i *Input) Buffer() termui.Buffer {
-	buf := i.par.Buffer()
+	buf := i.par.Block.Buffer()
+
+	lines := i.lines()
+	cursorLine, cursorX := i.cursor(lines)
+
+	// Scroll the lines to keep the cursor in sight
+	height := i.par.InnerBounds().Dy()
+	if cursorLine < i.offset {
+		i.offset = cursorLine
+	} else if cursorLine >= i.offset+height {
+		i.offset = cursorLine - height + 1
+	}
+	if i.offset > len(lines)-height {
+		i.offset = len(lines) - height
+	}
+	if i.offset < 0 {
+		i.offset = 0
+	}
+
+	// A line with a word longer than the Input is scrolled horizontally
+	// to keep the cursor in sight, other lines show their start
+	scroll := 0
+	if width := i.par.InnerBounds().Dx(); cursorX >= width {
+		scroll = cursorX - width + 1
+	}
+
+	y := i.par.InnerY()
+	for n := i.offset; n < len(lines); n++ {
+		if y >= i.par.InnerBounds().Max.Y {
+			break
+		}
+
+		skip := 0
+		if n == cursorLine {
+			skip = scroll
+		}
+
+		column := 0
+		for _, ch := range i.text[lines[n].start:lines[n].end] {
+			cell := termui.Cell{Ch: ch, Fg: i.par.TextFgColor, Bg: i.par.TextBgColor}
+			x := i.par.InnerX() + column - skip
+			column += cell.Width()
+			if x < i.par.InnerX() {
+				continue
+			}
+			if x+cell.Width() > i.par.InnerBounds().Max.X {
+				break
+			}
+			buf.Set(x, y, cell)
+		}
+		y++
+	}
 
 	// Set visible cursor
-	char := buf.At(i.par.InnerX()+i.cursorPosition, i.par.Block.InnerY())
+	x := i.par.InnerX() + cursorX - scroll
+	y = i.par.InnerY() + cursorLine - i.offset
+	char := buf.At(x, y)
 	buf.Set(
-		i.par.InnerX()+i.cursorPosition,
-		i.par.Block.InnerY(),
+		x, y,
 		termui.Cell{
 			Ch: char.Ch,
 			Fg: i.par.TextBgColor,
@@ -51,6 +131,7 @@ func (i *Input) GetHeight() int {
 // SetWidth implements interface termui.GridBufferer
 func (i *Input) SetWidth(w int) {
 	i.par.SetWidth(w)
+	i.resize()
 }
 
 // SetX implements interface termui.GridBufferer
@@ -65,31 +146,83 @@ func (i *Input) SetY(y int) {
 
 // Insert will insert a given key at the place of the current cursorPosition
 func (i *Input) Insert(key rune) {
-	if len(i.text) < i.par.InnerBounds().Dx()-1 {
-
-		first := append(i.text[0:i.cursorPosition], key)
-		i.text = append(first, i.text[i.cursorPosition:]...)
-
-		i.par.Text = string(i.text)
-		i.MoveCursorRight()
-	}
+	i.edit("insert")
+	i.replace(i.cursorPosition, i.cursorPosition, []rune{key})
+	i.cursorPosition++
 }
 
 // Backspace will remove a character in front of the cursorPosition
 func (i *Input) Backspace() {
 	if i.cursorPosition > 0 {
-		i.text = append(i.text[0:i.cursorPosition-1], i.text[i.cursorPosition:]...)
-		i.par.Text = string(i.text)
-		i.MoveCursorLeft()
+		i.edit("backspace")
+		i.replace(i.cursorPosition-1, i.cursorPosition, nil)
+		i.cursorPosition--
 	}
 }
 
 // Delete will remove a character at the cursorPosition
 func (i *Input) Delete() {
 	if i.cursorPosition < len(i.text) {
-		i.text = append(i.text[0:i.cursorPosition], i.text[i.cursorPosition+1:]...)
-		i.par.Text = string(i.text)
+		i.edit("delete")
+		i.replace(i.cursorPosition, i.cursorPosition+1, nil)
+	}
+}
+
+// BackspaceWord will remove the word in front of the cursorPosition, up
+// to the previous whitespace like C-w of readline
+func (i *Input) BackspaceWord() {
+	i.kill(i.wordStart(unicode.IsSpace), i.cursorPosition)
+}
+
+// DeleteWord will remove the text from the cursorPosition to the end of
+// the word
+func (i *Input) DeleteWord() {
+	i.kill(i.cursorPosition, i.wordEnd(isWordSeparator))
+}
+
+// KillLine will remove the text from the cursorPosition to the end of the
+// line, or the newline when the cursorPosition is at the end already
+func (i *Input) KillLine() {
+	end := i.lineEnd()
+	if end == i.cursorPosition && end < len(i.text) {
+		end++
+	}
+	i.kill(i.cursorPosition, end)
+}
+
+// Yank will insert the text removed by the last kills at the place of the
+// cursorPosition, consecutive kills are yanked at once
+func (i *Input) Yank() {
+	if len(i.killed) == 0 {
+		return
+	}
+
+	i.edit("yank")
+	i.replace(i.cursorPosition, i.cursorPosition, i.killed)
+	i.cursorPosition += len(i.killed)
+}
+
+// Undo will revert the last edit, consecutive edits of the same kind,
+// like typing a word, are reverted at once
+func (i *Input) Undo() {
+	if len(i.undo) == 0 {
+		return
+	}
+
+	i.redo = append(i.redo, i.state())
+	i.restore(i.undo[len(i.undo)-1])
+	i.undo = i.undo[:len(i.undo)-1]
+}
+
+// Redo will apply the last edit that was reverted by Undo again
+func (i *Input) Redo() {
+	if len(i.redo) == 0 {
+		return
 	}
+
+	i.undo = append(i.undo, i.state())
+	i.restore(i.redo[len(i.redo)-1])
+	i.redo = i.redo[:len(i.redo)-1]
 }
 
 // MoveCursorRight will increase the current cursorPosition with 1
@@ -97,6 +230,7 @@ func (i *Input) MoveCursorRight() {
 	if i.cursorPosition < len(i.text) {
 		i.cursorPosition++
 	}
+	i.lastEdit = ""
 }
 
 // MoveCursorLeft will decrease the current cursorPosition with 1
@@ -104,6 +238,33 @@ func (i *Input) MoveCursorLeft() {
 	if i.cursorPosition > 0 {
 		i.cursorPosition--
 	}
+	i.lastEdit = ""
+}
+
+// MoveCursorWordRight will move the cursorPosition to the end of the word
+func (i *Input) MoveCursorWordRight() {
+	i.cursorPosition = i.wordEnd(isWordSeparator)
+	i.lastEdit = ""
+}
+
+// MoveCursorWordLeft will move the cursorPosition to the start of the word
+func (i *Input) MoveCursorWordLeft() {
+	i.cursorPosition = i.wordStart(isWordSeparator)
+	i.lastEdit = ""
+}
+
+// MoveCursorStart will move the cursorPosition to the start of the line
+func (i *Input) MoveCursorStart() {
+	for i.cursorPosition > 0 && i.text[i.cursorPosition-1] != '\n' {
+		i.cursorPosition--
+	}
+	i.lastEdit = ""
+}
+
+// MoveCursorEnd will move the cursorPosition to the end of the line
+func (i *Input) MoveCursorEnd() {
+	i.cursorPosition = i.lineEnd()
+	i.lastEdit = ""
 }
 
 // IsEmpty will return true when the input is empty
@@ -114,14 +275,210 @@ func (i *Input) IsEmpty() bool {
 	return false
 }
 
-// Clear will empty the input and move the cursor to the start position
+// Clear will empty the input and move the cursor to the start position,
+// the label and the edits to undo are removed as well
 func (i *Input) Clear() {
-	i.text = make([]rune, 0)
-	i.par.Text = ""
-	i.cursorPosition = 0
+	i.SetText("")
+	i.par.BorderLabel = ""
+}
+
+// SetText replaces the text of the input and moves the cursor to the end,
+// the edits of the previous text can't be undone anymore
+func (i *Input) SetText(text string) {
+	i.text = []rune(text)
+	i.par.Text = text
+	i.cursorPosition = len(i.text)
+	i.undo = nil
+	i.redo = nil
+	i.lastEdit = ""
+	i.resize()
+}
+
+// SetBorderLabel sets the label of the input, e.g. to show a question
+func (i *Input) SetBorderLabel(label string) {
+	i.par.BorderLabel = label
+}
+
+// GetBorderLabel returns the label of the input
+func (i *Input) GetBorderLabel() string {
+	return i.par.BorderLabel
 }
 
 // GetText returns the text currently in the input
 func (i *Input) GetText() string {
 	return i.par.Text
 }
+
+// edit saves the state before an edit of kind for Undo, unless the last
+// edit was of the same kind
+func (i *Input) edit(kind string) {
+	if kind != i.lastEdit {
+		i.undo = append(i.undo, i.state())
+		if len(i.undo) > undoSize {
+			i.undo = i.undo[1:]
+		}
+	}
+	i.redo = nil
+	i.lastEdit = kind
+}
+
+// kill removes the text between start and end and keeps it for Yank,
+// consecutive kills are kept together
+func (i *Input) kill(start int, end int) {
+	if start == end {
+		return
+	}
+
+	removed := append([]rune(nil), i.text[start:end]...)
+	switch {
+	case i.lastEdit != "kill":
+		i.killed = removed
+	case start < i.cursorPosition:
+		i.killed = append(removed, i.killed...)
+	default:
+		i.killed = append(i.killed, removed...)
+	}
+
+	i.edit("kill")
+	i.replace(start, end, nil)
+	i.cursorPosition = start
+}
+
+// replace replaces the text between start and end with text, the text of
+// the input is copied so the states saved for Undo are left untouched
+func (i *Input) replace(start int, end int, text []rune) {
+	replaced := make([]rune, 0, len(i.text)-(end-start)+len(text))
+	replaced = append(replaced, i.text[:start]...)
+	replaced = append(replaced, text...)
+	replaced = append(replaced, i.text[end:]...)
+
+	i.text = replaced
+	i.par.Text = string(i.text)
+	i.resize()
+}
+
+// state returns the current text and cursor
+func (i *Input) state() inputState {
+	return inputState{text: i.text, cursorPosition: i.cursorPosition}
+}
+
+// restore brings back the text and cursor of state
+func (i *Input) restore(state inputState) {
+	i.text = state.text
+	i.par.Text = string(i.text)
+	i.cursorPosition = state.cursorPosition
+	i.lastEdit = ""
+	i.resize()
+}
+
+// resize sets the height of the Input to the number of lines of the text,
+// up to maxLines
+func (i *Input) resize() {
+	lines := len(i.lines())
+	if lines > i.maxLines {
+		lines = i.maxLines
+	}
+	i.par.Height = lines + 2
+}
+
+// lines wraps the text at spaces to fit the width of the Input, the last
+// column is kept free for the cursor. A word that is longer than the width
+// isn't broken up, Buffer scrolls its line horizontally instead.
+func (i *Input) lines() []inputLine {
+	width := i.par.InnerBounds().Dx() - 1
+
+	var lines []inputLine
+	start, x := 0, 0
+	wrap := 0 // position after the last space, where the line can wrap
+	for n, ch := range i.text {
+		if ch == '\n' {
+			lines = append(lines, inputLine{start: start, end: n})
+			start, x, wrap = n+1, 0, n+1
+			continue
+		}
+
+		w := termui.Cell{Ch: ch}.Width()
+		if x+w > width {
+			if ch == ' ' {
+				// A space that doesn't fit ends the line, it takes the
+				// column that is kept free for the cursor
+				lines = append(lines, inputLine{start: start, end: n + 1})
+				start, x, wrap = n+1, 0, n+1
+				continue
+			}
+			if wrap > start {
+				lines = append(lines, inputLine{start: start, end: wrap})
+				x = 0
+				for _, c := range i.text[wrap:n] {
+					x += termui.Cell{Ch: c}.Width()
+				}
+				start = wrap
+			}
+		}
+		x += w
+
+		if ch == ' ' {
+			wrap = n + 1
+		}
+	}
+
+	return append(lines, inputLine{start: start, end: len(i.text)})
+}
+
+// cursor returns the line and column of the cursorPosition in lines, at
+// the end of a wrapped line the cursor is at the start of the next one
+func (i *Input) cursor(lines []inputLine) (int, int) {
+	line := 0
+	for n := range lines {
+		if lines[n].start <= i.cursorPosition {
+			line = n
+		}
+	}
+
+	x := 0
+	for _, ch := range i.text[lines[line].start:i.cursorPosition] {
+		x += termui.Cell{Ch: ch}.Width()
+	}
+	return line, x
+}
+
+// lineEnd returns the position of the end of the line of the cursor
+func (i *Input) lineEnd() int {
+	position := i.cursorPosition
+	for position < len(i.text) && i.text[position] != '\n' {
+		position++
+	}
+	return position
+}
+
+// wordStart returns the position of the start of the word in front of the
+// cursor, words are separated by the runes for which separator is true
+func (i *Input) wordStart(separator func(rune) bool) int {
+	position := i.cursorPosition
+	for position > 0 && separator(i.text[position-1]) {
+		position--
+	}
+	for position > 0 && !separator(i.text[position-1]) {
+		position--
+	}
+	return position
+}
+
+// wordEnd returns the position of the end of the word after the cursor,
+// see wordStart
+func (i *Input) wordEnd(separator func(rune) bool) int {
+	position := i.cursorPosition
+	for position < len(i.text) && separator(i.text[position]) {
+		position++
+	}
+	for position < len(i.text) && !separator(i.text[position]) {
+		position++
+	}
+	return position
+}
+
+// isWordSeparator returns true for the runes that aren't part of words,
+// like whitespace and punctuation
+func isWordSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
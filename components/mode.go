@@ -5,6 +5,10 @@ import "github.com/gizak/termui"
 // Mode is the definition of Mode component
 type Mode struct {
 	par *termui.Par
+
+	// status is shown instead of the mode while it is set, e.g. the
+	// progress of an upload
+	status string
 }
 
 // CreateMode is the constructor of the Mode struct
@@ -22,18 +26,23 @@ func CreateMode() *Mode {
 func (m *Mode) Buffer() termui.Buffer {
 	buf := m.par.Buffer()
 
+	text := m.par.Text
+	if m.status != "" {
+		text = m.status
+	}
+
+	cells := termui.DefaultTxBuilder.Build(
+		text, m.par.TextFgColor, m.par.TextBgColor)
+
 	// Center text
 	space := m.par.InnerWidth()
-	word := len(m.par.Text)
+	word := len(cells)
 
 	midSpace := space / 2
 	midWord := word / 2
 
 	start := midSpace - midWord
 
-	cells := termui.DefaultTxBuilder.Build(
-		m.par.Text, m.par.TextFgColor, m.par.TextBgColor)
-
 	i, j := 0, 0
 	x := m.par.InnerBounds().Min.X
 	for x < m.par.InnerBounds().Max.X {
@@ -85,3 +94,9 @@ func (m *Mode) SetY(y int) {
 func (m *Mode) SetText(text string) {
 	m.par.Text = text
 }
+
+// SetStatus sets a status that is shown instead of the mode, an empty
+// status shows the mode again
+func (m *Mode) SetStatus(status string) {
+	m.status = status
+}
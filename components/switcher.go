@@ -0,0 +1,282 @@
+package components
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gizak/termui"
+
+	"github.com/jvalduvieco/slack-term/service"
+)
+
+// switcherRows is the number of matching channels the Switcher shows at
+// once
+const switcherRows = 10
+
+// Bonuses that rank channels higher in the Switcher. The last visited
+// channel gets the full recentBonus, the channel visited before that one
+// point less, and so on.
+const (
+	unreadBonus = 15
+	recentBonus = 10
+)
+
+// SwitcherItem is a channel that can be switched to with the Switcher
+type SwitcherItem struct {
+	Channel   service.Channel
+	Unread    bool
+	LastVisit int    // see Channels.GetLastVisit
+	Detail    string // shown after the name of the channel
+}
+
+// switcherMatch is a SwitcherItem that matches the query of the Switcher
+type switcherMatch struct {
+	item  SwitcherItem
+	score int
+}
+
+// Switcher is the definition of a Switcher component, an overlay that
+// fuzzy matches a query against the names of channels to quickly switch
+// to one of them. It is used to browse the channels that can be joined
+// as well.
+type Switcher struct {
+	block    *termui.Block
+	items    []SwitcherItem
+	recent   map[string]int // bonus of the recently visited channels by ID
+	query    []rune
+	matches  []switcherMatch
+	selected int // index of the highlighted match
+	offset   int // index of the first match that is shown
+	open     bool
+}
+
+// CreateSwitcher is the constructor for the Switcher struct, label is
+// shown in its border
+func CreateSwitcher(label string) *Switcher {
+	switcher := &Switcher{
+		block: termui.NewBlock(),
+	}
+
+	switcher.block.BorderLabel = label
+	switcher.block.Height = switcherRows + 3
+
+	return switcher
+}
+
+// Buffer implements interface termui.Bufferer
+func (s *Switcher) Buffer() termui.Buffer {
+	// The Switcher is centered horizontally in the upper part of the
+	// terminal
+	width := termui.TermWidth() * 3 / 5
+	if width < 30 {
+		width = termui.TermWidth()
+	}
+	s.block.Width = width
+	s.block.X = (termui.TermWidth() - width) / 2
+	s.block.Y = termui.TermHeight() / 5
+
+	buf := s.block.Buffer()
+	bounds := s.block.InnerBounds()
+	fg, bg := termui.ThemeAttr("fg"), termui.ThemeAttr("bg")
+
+	// The query is shown on the first line followed by the cursor
+	x := bounds.Min.X
+	for _, cell := range termui.DefaultTxBuilder.Build("> "+string(s.query), fg, bg) {
+		buf.Set(x, bounds.Min.Y, cell)
+		x += cell.Width()
+	}
+	buf.Set(x, bounds.Min.Y, termui.Cell{Ch: ' ', Fg: bg, Bg: fg})
+
+	if len(s.matches) == 0 {
+		s.setLine(&buf, bounds.Min.Y+1, "  no matching channels", termui.ColorBlue, bg)
+	}
+
+	for i := 0; i < switcherRows && s.offset+i < len(s.matches); i++ {
+		item := s.matches[s.offset+i].item
+
+		marker := " "
+		if item.Unread {
+			marker = "*"
+		}
+		text := fmt.Sprintf("%s [%s] %s", marker, item.Channel.ClientID, item.Channel.Name)
+		if item.Detail != "" {
+			text += "  " + item.Detail
+		}
+
+		if s.offset+i == s.selected {
+			s.setLine(&buf, bounds.Min.Y+1+i, text, bg, fg)
+		} else {
+			s.setLine(&buf, bounds.Min.Y+1+i, text, fg, bg)
+		}
+	}
+
+	return buf
+}
+
+// setLine sets the cells of a line of text at y, the line is filled up
+// to the border
+func (s *Switcher) setLine(buf *termui.Buffer, y int, text string, fg termui.Attribute, bg termui.Attribute) {
+	bounds := s.block.InnerBounds()
+
+	cells := termui.DTrimTxCls(
+		termui.DefaultTxBuilder.Build(text, fg, bg), bounds.Dx())
+
+	x := bounds.Min.X
+	for _, cell := range cells {
+		buf.Set(x, y, cell)
+		x += cell.Width()
+	}
+	for x < bounds.Max.X {
+		buf.Set(x, y, termui.Cell{Ch: ' ', Fg: fg, Bg: bg})
+		x++
+	}
+}
+
+// Open opens the Switcher on items with an empty query
+func (s *Switcher) Open(items []SwitcherItem) {
+	s.items = items
+	s.query = nil
+	s.open = true
+
+	// Rank the visited channels by their last visit
+	var visited []SwitcherItem
+	for _, item := range items {
+		if item.LastVisit > 0 {
+			visited = append(visited, item)
+		}
+	}
+	sort.Slice(visited, func(i, j int) bool {
+		return visited[i].LastVisit > visited[j].LastVisit
+	})
+
+	s.recent = make(map[string]int)
+	for i, item := range visited {
+		if i >= recentBonus {
+			break
+		}
+		s.recent[item.Channel.ID] = recentBonus - i
+	}
+
+	s.filter()
+}
+
+// Close closes the Switcher
+func (s *Switcher) Close() {
+	s.open = false
+	s.items = nil
+	s.matches = nil
+}
+
+// IsOpen returns true when the Switcher is shown
+func (s *Switcher) IsOpen() bool {
+	return s.open
+}
+
+// Insert adds key to the query
+func (s *Switcher) Insert(key rune) {
+	s.query = append(s.query, key)
+	s.filter()
+}
+
+// Backspace removes the last character of the query
+func (s *Switcher) Backspace() {
+	if len(s.query) > 0 {
+		s.query = s.query[:len(s.query)-1]
+		s.filter()
+	}
+}
+
+// SelectPrevious highlights the match above the highlighted match
+func (s *Switcher) SelectPrevious() {
+	if s.selected > 0 {
+		s.selected--
+	}
+	if s.selected < s.offset {
+		s.offset = s.selected
+	}
+}
+
+// SelectNext highlights the match below the highlighted match
+func (s *Switcher) SelectNext() {
+	if s.selected < len(s.matches)-1 {
+		s.selected++
+	}
+	if s.selected >= s.offset+switcherRows {
+		s.offset = s.selected - switcherRows + 1
+	}
+}
+
+// GetSelectedChannel returns the highlighted channel, ok is false when no
+// channel matches the query
+func (s *Switcher) GetSelectedChannel() (service.Channel, bool) {
+	if s.selected >= len(s.matches) {
+		return service.Channel{}, false
+	}
+	return s.matches[s.selected].item.Channel, true
+}
+
+// filter matches the query against the channels, the best match is
+// highlighted
+func (s *Switcher) filter() {
+	s.matches = nil
+	for _, item := range s.items {
+		score, ok := fuzzyScore(s.query, item.Channel.Name)
+		if !ok {
+			continue
+		}
+		if item.Unread {
+			score += unreadBonus
+		}
+		score += s.recent[item.Channel.ID]
+
+		s.matches = append(s.matches, switcherMatch{item: item, score: score})
+	}
+
+	// Channels that score the same keep the order of the Channels list
+	sort.SliceStable(s.matches, func(i, j int) bool {
+		return s.matches[i].score > s.matches[j].score
+	})
+
+	s.selected = 0
+	s.offset = 0
+}
+
+// fuzzyScore returns how well query matches text, regardless of case. The
+// characters of query have to appear in text in the same order, ok is
+// false when they don't. Consecutive characters and characters at the
+// start of a word, like the "d" of "team-dev", score higher, as do short
+// texts.
+func fuzzyScore(query []rune, text string) (score int, ok bool) {
+	if len(query) == 0 {
+		return 0, true
+	}
+
+	runes := []rune(strings.ToLower(text))
+
+	matched, previous := 0, -2
+	for i, r := range runes {
+		if matched == len(query) {
+			break
+		}
+		if r != unicode.ToLower(query[matched]) {
+			continue
+		}
+
+		score++
+		if i == previous+1 {
+			score += 5
+		}
+		if i == 0 || strings.ContainsRune("-_. ", runes[i-1]) {
+			score += 10
+		}
+		previous = i
+		matched++
+	}
+
+	if matched < len(query) {
+		return 0, false
+	}
+	return score - len(runes)/4, true
+}
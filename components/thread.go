@@ -0,0 +1,166 @@
+package components
+
+import (
+	"github.com/gizak/termui"
+
+	"github.com/jvalduvieco/slack-term/service"
+)
+
+// Thread is the definition of a Thread component, it shows the replies
+// of a thread next to the Chat pane
+type Thread struct {
+	chat            *Chat
+	channelID       string
+	threadTimestamp string
+	broadcast       bool // whether replies are sent to the channel as well
+	open            bool
+}
+
+// CreateThread is the constructor for the Thread struct
+func CreateThread(inputHeight int) *Thread {
+	thread := &Thread{
+		chat: CreateChat(inputHeight, "", ""),
+	}
+
+	thread.setBorderLabel()
+
+	return thread
+}
+
+// Buffer implements interface termui.Bufferer
+func (t *Thread) Buffer() termui.Buffer {
+	return t.chat.Buffer()
+}
+
+// GetHeight implements interface termui.GridBufferer
+func (t *Thread) GetHeight() int {
+	return t.chat.GetHeight()
+}
+
+// SetWidth implements interface termui.GridBufferer
+func (t *Thread) SetWidth(w int) {
+	t.chat.SetWidth(w)
+}
+
+// SetX implements interface termui.GridBufferer
+func (t *Thread) SetX(x int) {
+	t.chat.SetX(x)
+}
+
+// SetY implements interface termui.GridBufferer
+func (t *Thread) SetY(y int) {
+	t.chat.SetY(y)
+}
+
+// SetHeight sets the height of the widget, see View.layout
+func (t *Thread) SetHeight(h int) {
+	t.chat.SetHeight(h)
+}
+
+// Open shows the thread of the message with threadTimestamp in channelID,
+// messages contains the parent followed by the replies
+func (t *Thread) Open(channelID string, threadTimestamp string, messages []service.Message) {
+	t.chat.ClearMessages()
+	t.chat.SetHistoryComplete()
+	t.chat.AddMessages(messages)
+
+	t.channelID = channelID
+	t.threadTimestamp = threadTimestamp
+	t.broadcast = false
+	t.open = true
+	t.setBorderLabel()
+}
+
+// Close hides the thread
+func (t *Thread) Close() {
+	t.chat.ClearMessages()
+	t.channelID = ""
+	t.threadTimestamp = ""
+	t.open = false
+}
+
+// IsOpen returns true when a thread is shown
+func (t *Thread) IsOpen() bool {
+	return t.open
+}
+
+// IsShowing returns true when the thread of the message with
+// threadTimestamp in channelID is shown
+func (t *Thread) IsShowing(channelID string, threadTimestamp string) bool {
+	return t.open && t.channelID == channelID && t.threadTimestamp == threadTimestamp
+}
+
+// GetChannelID returns the channel of the thread
+func (t *Thread) GetChannelID() string {
+	return t.channelID
+}
+
+// GetThreadTimestamp returns the timestamp of the parent message
+func (t *Thread) GetThreadTimestamp() string {
+	return t.threadTimestamp
+}
+
+// AddMessage adds a reply to the thread
+func (t *Thread) AddMessage(message service.Message) {
+	t.chat.AddMessage(message)
+}
+
+// UpdateMessage replaces a message of the thread, see Chat.UpdateMessage
+func (t *Thread) UpdateMessage(message service.Message) bool {
+	return t.chat.UpdateMessage(message)
+}
+
+// DeleteMessage replaces a message of the thread with a placeholder
+func (t *Thread) DeleteMessage(timestamp string) {
+	t.chat.DeleteMessage(timestamp)
+}
+
+// AddReaction adds a reaction to a message of the thread
+func (t *Thread) AddReaction(timestamp string, name string, userID string) {
+	t.chat.AddReaction(timestamp, name, userID)
+}
+
+// RemoveReaction removes a reaction from a message of the thread
+func (t *Thread) RemoveReaction(timestamp string, name string, userID string) {
+	t.chat.RemoveReaction(timestamp, name, userID)
+}
+
+// SetCustomEmoji sets the custom emoji of the team of the thread
+func (t *Thread) SetCustomEmoji(emoji map[string]string) {
+	t.chat.SetCustomEmoji(emoji)
+}
+
+// SetCurrentUserID sets the ID of the user that is logged in on the team
+// of the thread
+func (t *Thread) SetCurrentUserID(userID string) {
+	t.chat.SetCurrentUserID(userID)
+}
+
+// ScrollUp scrolls the replies up, see Chat.ScrollUp
+func (t *Thread) ScrollUp() {
+	t.chat.ScrollUp()
+}
+
+// ScrollDown scrolls the replies down, see Chat.ScrollDown
+func (t *Thread) ScrollDown() {
+	t.chat.ScrollDown()
+}
+
+// ToggleBroadcast toggles whether replies are sent to the channel as well
+func (t *Thread) ToggleBroadcast() {
+	t.broadcast = !t.broadcast
+	t.setBorderLabel()
+}
+
+// IsBroadcast returns true when replies are sent to the channel as well
+func (t *Thread) IsBroadcast() bool {
+	return t.broadcast
+}
+
+func (t *Thread) setBorderLabel() {
+	if t.broadcast {
+		t.chat.SetBorderLabel("Thread", "also send to channel")
+	} else {
+		t.chat.SetBorderLabel("Thread", "")
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"os"
+	"os/user"
+	"path"
+	"strings"
 
 	"github.com/gizak/termui"
 )
@@ -11,20 +14,34 @@ import (
 // Config is the definition of a Config struct
 type Config struct {
 	SlackTokens  map[string]string     `json:"slack_token"`
+	APIURL       string                `json:"api_url"`
+	CacheDir     string                `json:"cache_dir"`
 	Theme        string                `json:"theme"`
 	SidebarWidth int                   `json:"sidebar_width"`
 	MainWidth    int                   `json:"-"`
 	KeyMap       map[string]keyMapping `json:"key_map"`
+	DownloadDir  string                `json:"download_dir"`
+	Leader       string                `json:"leader"`
+	KeyTimeout   int                   `json:"key_timeout"`
+	InputLines   int                   `json:"input_lines"`
 }
 
 type keyMapping map[string]string
 
+// ErrNoSlackToken is returned by NewConfig when the config file doesn't
+// contain any slack token. The returned Config is otherwise complete.
+var ErrNoSlackToken = errors.New("couldn't find 'slack_token' parameter")
+
 // NewConfig loads the config file and returns a Config struct
 func NewConfig(filepath string) (*Config, error) {
 	cfg := Config{
 		Theme:        "dark",
+		CacheDir:     path.Join(path.Dir(filepath), "cache"),
 		SidebarWidth: 1,
 		MainWidth:    11,
+		Leader:       "\\",
+		KeyTimeout:   1000,
+		InputLines:   5,
 		KeyMap: map[string]keyMapping{
 			"command": {
 				"i":          "mode-insert",
@@ -38,8 +55,19 @@ func NewConfig(filepath string) (*Config, error) {
 				"<next>":     "chat-down",
 				"C-f":        "chat-down",
 				"C-d":        "chat-down",
+				"t":          "thread-open",
+				"T":          "thread-close",
+				"B":          "thread-broadcast",
+				"C-y":        "thread-up",
+				"C-e":        "thread-down",
+				"s":          "mode-select",
 				"q":          "quit",
 				"<f1>":       "help",
+				"C-k":        "switch-open",
+				"b":          "browse-open",
+				"L":          "channel-leave",
+				":":          "mode-ex",
+				"E":          "compose-send",
 			},
 			"insert": {
 				"<left>":      "cursor-left",
@@ -50,10 +78,78 @@ func NewConfig(filepath string) (*Config, error) {
 				"C-8":         "backspace",
 				"<delete>":    "delete",
 				"<space>":     "space",
+				"M-<enter>":   "newline",
+				"C-a":         "cursor-start",
+				"C-e":         "cursor-end",
+				"M-f":         "word-right",
+				"M-b":         "word-left",
+				"C-w":         "word-backspace",
+				"M-d":         "word-delete",
+				"C-k":         "kill-line",
+				"C-y":         "yank",
+				"C-/":         "undo",
+				"M-/":         "redo",
+				"C-xC-e":      "compose",
+			},
+			"select": {
+				"k":        "select-up",
+				"<up>":     "select-up",
+				"j":        "select-down",
+				"<down>":   "select-down",
+				"t":        "thread-open",
+				"e":        "message-edit",
+				"d":        "message-delete",
+				"r":        "react",
+				"y":        "copy",
+				"o":        "open-link",
+				"D":        "file-download",
+				"p":        "file-preview",
+				"<escape>": "mode-command",
+			},
+			"switcher": {
+				"<up>":        "switch-up",
+				"C-p":         "switch-up",
+				"<down>":      "switch-down",
+				"C-n":         "switch-down",
+				"<enter>":     "switch-select",
+				"<escape>":    "switch-close",
+				"<backspace>": "switch-backspace",
+				"C-8":         "switch-backspace",
+			},
+			"ex": {
+				"<left>":      "cursor-left",
+				"<right>":     "cursor-right",
+				"<enter>":     "ex-run",
+				"<escape>":    "ex-cancel",
+				"<tab>":       "ex-complete",
+				"<up>":        "ex-previous",
+				"C-p":         "ex-previous",
+				"<down>":      "ex-next",
+				"C-n":         "ex-next",
+				"<backspace>": "ex-backspace",
+				"C-8":         "ex-backspace",
+				"<delete>":    "delete",
+				"<space>":     "space",
+			},
+			"browser": {
+				"<up>":        "browse-up",
+				"C-p":         "browse-up",
+				"<down>":      "browse-down",
+				"C-n":         "browse-down",
+				"<enter>":     "browse-join",
+				"<escape>":    "browse-close",
+				"<backspace>": "browse-backspace",
+				"C-8":         "browse-backspace",
 			},
 		},
 	}
 
+	// Files are downloaded to ~/Downloads unless configured otherwise
+	usr, err := user.Current()
+	if err == nil {
+		cfg.DownloadDir = path.Join(usr.HomeDir, "Downloads")
+	}
+
 	file, err := os.Open(filepath)
 	if err != nil {
 		return &cfg, err
@@ -63,16 +159,24 @@ func NewConfig(filepath string) (*Config, error) {
 		return &cfg, err
 	}
 
-	if len(cfg.SlackTokens) == 0 {
-		return &cfg, errors.New("couldn't find 'slack_token' parameter")
-	}
-
 	if cfg.SidebarWidth < 1 || cfg.SidebarWidth > 11 {
 		return &cfg, errors.New("please specify the 'sidebar_width' between 1 and 11")
 	}
 
 	cfg.MainWidth = 12 - cfg.SidebarWidth
 
+	if cfg.KeyTimeout < 0 {
+		return &cfg, errors.New("please specify the 'key_timeout' in milliseconds, 0 waits forever")
+	}
+
+	if cfg.InputLines < 1 {
+		return &cfg, errors.New("please specify the 'input_lines' as 1 or more")
+	}
+
+	if strings.HasPrefix(cfg.DownloadDir, "~/") && usr != nil {
+		cfg.DownloadDir = path.Join(usr.HomeDir, cfg.DownloadDir[2:])
+	}
+
 	if cfg.Theme == "light" {
 		termui.ColorMap = map[string]termui.Attribute{
 			"fg":           termui.ColorBlack,
@@ -84,5 +188,9 @@ func NewConfig(filepath string) (*Config, error) {
 		}
 	}
 
+	if len(cfg.SlackTokens) == 0 {
+		return &cfg, ErrNoSlackToken
+	}
+
 	return &cfg, nil
 }
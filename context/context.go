@@ -1,7 +1,11 @@
 package context
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"os"
+	"sync"
 
 	termbox "github.com/nsf/termbox-go"
 
@@ -15,28 +19,72 @@ const (
 	CommandMode = "command"
 	// InsertMode sets the app into insert mode
 	InsertMode = "insert"
+	// SelectMode sets the app into select mode, where a message of the
+	// Chat pane is highlighted
+	SelectMode = "select"
+	// ConfirmMode sets the app into confirm mode, where a prompt has to
+	// be answered with y or n
+	ConfirmMode = "confirm"
+	// SwitcherMode sets the app into switcher mode, where a channel is
+	// picked in the Switcher
+	SwitcherMode = "switcher"
+	// BrowserMode sets the app into browser mode, where a channel to
+	// join is picked in the Browser
+	BrowserMode = "browser"
+	// ExMode sets the app into ex mode, where a command is typed in the
+	// Input, like the command line of vim
+	ExMode = "ex"
+)
+
+const (
+	// SlackBackend connects to slack using the tokens from the config
+	SlackBackend = "slack"
+	// FakeBackend serves channels and messages from a fixture file
+	FakeBackend = "fake"
 )
 
 // AppContext contains all app services and views
 type AppContext struct {
 	EventQueue chan termbox.Event
-	Service    *service.SlackService
+	Service    service.Backend
 	View       *views.View
 	Config     *config.Config
 	Mode       string
+	Count      int // count typed before the keys of the running action
+
+	// Suspend gives the terminal back while run runs, e.g. to open an
+	// editor, it is set by main which owns the terminal
+	Suspend func(run func() error) error
+
+	mu sync.Mutex
+}
+
+// Lock is held while a handler changes the app, the handlers run in
+// goroutines of their own, e.g. for keys and for incoming events. Slow
+// work like requests to slack is better done before taking it.
+func (ctx *AppContext) Lock() {
+	ctx.mu.Lock()
+}
+
+// Unlock releases the lock taken by Lock
+func (ctx *AppContext) Unlock() {
+	ctx.mu.Unlock()
 }
 
 // CreateAppContext creates an application context which can be passed
 // and referenced througout the application
-func CreateAppContext(flgConfig string) *AppContext {
+func CreateAppContext(flgConfig string, flgBackend string, flgFixtures string) *AppContext {
 	// Load appConfig
-	appConfig, err := config.NewConfig(flgConfig)
+	appConfig, err := loadConfig(flgConfig, flgBackend)
 	if err != nil {
 		log.Fatalf("ERROR: not able to load appConfig file (%s): %s", flgConfig, err)
 	}
 
 	// Create Service
-	svc := service.CreateSlackService(appConfig.SlackTokens)
+	svc, err := createBackend(appConfig, flgBackend, flgFixtures)
+	if err != nil {
+		log.Fatalf("ERROR: not able to create %s backend: %s", flgBackend, err)
+	}
 
 	// Create ChatView
 	view := views.CreateUIComponents(appConfig, svc)
@@ -49,3 +97,54 @@ func CreateAppContext(flgConfig string) *AppContext {
 		Mode:       CommandMode,
 	}
 }
+
+// CreateBackend creates the Backend selected by flgBackend without the
+// views, for commands that don't show the terminal user interface
+func CreateBackend(flgConfig string, flgBackend string, flgFixtures string) (service.Backend, error) {
+	appConfig, err := loadConfig(flgConfig, flgBackend)
+	if err != nil {
+		return nil, fmt.Errorf("not able to load config file (%s): %s", flgConfig, err)
+	}
+
+	return createBackend(appConfig, flgBackend, flgFixtures)
+}
+
+// loadConfig loads the config file, the fake backend doesn't need any
+// tokens, so it is fine with the defaults when there is no config file
+func loadConfig(flgConfig string, flgBackend string) (*config.Config, error) {
+	appConfig, err := config.NewConfig(flgConfig)
+	if err != nil {
+		if flgBackend != FakeBackend || !(os.IsNotExist(err) || err == config.ErrNoSlackToken) {
+			return nil, err
+		}
+	}
+	return appConfig, nil
+}
+
+// createBackend creates the Backend selected by flgBackend
+func createBackend(appConfig *config.Config, flgBackend string, flgFixtures string) (service.Backend, error) {
+	switch flgBackend {
+	case SlackBackend:
+		// The cache is an optimization, so we carry on without it
+		// when it can't be opened
+		cache, err := service.OpenMessageCache(appConfig.CacheDir)
+		if err != nil {
+			cache = nil
+		}
+
+		return service.CreateSlackService(appConfig.SlackTokens, appConfig.APIURL, cache)
+	case FakeBackend:
+		if flgFixtures == "" {
+			return nil, errors.New("please specify a fixture file with -fixtures")
+		}
+
+		fixtures, err := service.LoadFixtures(flgFixtures)
+		if err != nil {
+			return nil, err
+		}
+
+		return service.CreateFakeService(fixtures)
+	}
+
+	return nil, fmt.Errorf("unknown backend '%s'", flgBackend)
+}
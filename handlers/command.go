@@ -0,0 +1,524 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jvalduvieco/slack-term/context"
+	"github.com/jvalduvieco/slack-term/service"
+	"github.com/jvalduvieco/slack-term/views"
+)
+
+// statusTimeout is how long a status, like FAILED for a failed upload,
+// stays in the Mode component
+const statusTimeout = 3 * time.Second
+
+// commandMap binds the names of the commands that can be run from ex mode
+// to their functions. The function is passed the text following the name
+// of the command.
+var commandMap = map[string]func(*context.AppContext, string){
+	"upload": commandUpload,
+	"create": commandCreate,
+	"dm":     commandDirectMessage,
+	"mpdm":   commandGroupMessage,
+	"join":   commandJoin,
+	"part":   commandPart,
+	"topic":  commandTopic,
+	"q":      commandQuit,
+	"quit":   commandQuit,
+	"set":    commandSet,
+}
+
+// completionMap binds the names of commands to the functions that return
+// the candidates to complete their arguments with in ex mode, see
+// actionExComplete. The function is passed the preceding arguments and
+// the argument that is completed.
+var completionMap = map[string]func(*context.AppContext, []string, string) []string{
+	"upload": completePath,
+	"create": completeCreate,
+	"dm":     completeUser,
+	"mpdm":   completeUsers,
+	"join":   completeUnjoined,
+	"part":   completeJoined,
+	"set":    completeSetting,
+}
+
+// :map is registered apart, because it refers to actionMap which refers
+// to commandMap through the ex mode actions
+func init() {
+	commandMap["map"] = commandMapKey
+	completionMap["map"] = completeMapKey
+}
+
+// settingMap binds the names of the settings that can be changed with
+// :set to the functions that change them
+var settingMap = map[string]func(*context.AppContext, string) error{
+	"sidebar_width": setSidebarWidth,
+	"download_dir":  setDownloadDir,
+}
+
+// runCommand runs message when it is an :upload command sent from the
+// Input and returns true, or returns false otherwise. The other commands
+// are only run from ex mode, so messages like :wave: or ":q" are sent as
+// usual.
+func runCommand(ctx *context.AppContext, message string) bool {
+	name, args := splitFirstWord(message)
+	if !strings.HasPrefix(message, ":") || name != ":upload" {
+		return false
+	}
+
+	commandUpload(ctx, args)
+	return true
+}
+
+// splitFirstWord splits text into its first word and the remainder
+func splitFirstWord(text string) (string, string) {
+	text = strings.TrimSpace(text)
+	if i := strings.IndexAny(text, " \t"); i >= 0 {
+		return text[:i], strings.TrimSpace(text[i+1:])
+	}
+	return text, ""
+}
+
+// commandUpload uploads a file to the selected channel:
+//
+//	:upload <path> [comment]
+//
+// The progress of the upload is shown in the Mode component.
+func commandUpload(ctx *context.AppContext, args string) {
+	path, comment := splitFirstWord(args)
+	if path == "" {
+		showError(ctx, errors.New("usage: :upload <path> [comment]"))
+		return
+	}
+
+	path = expandHome(path)
+	file, err := os.Open(path)
+	if err != nil {
+		showError(ctx, err)
+		return
+	}
+
+	info, err := file.Stat()
+	if err == nil && info.IsDir() {
+		err = fmt.Errorf("%s is a directory", path)
+	}
+	if err != nil {
+		file.Close()
+		showError(ctx, err)
+		return
+	}
+
+	reader := &progressReader{
+		r:        file,
+		progress: showProgress(ctx, "↑", info.Size()),
+	}
+
+	channelID := ctx.View.Channels.GetSelectedChannelID()
+	go func() {
+		defer file.Close()
+
+		err := ctx.Service.UploadFile(channelID, filepath.Base(path), reader, comment)
+
+		ctx.Lock()
+		defer ctx.Unlock()
+		if err != nil {
+			showError(ctx, err)
+			return
+		}
+		ctx.View.Mode.SetStatus("")
+		views.Render(ctx.View.Mode)
+	}()
+}
+
+// commandCreate creates a channel on the team of the selected channel and
+// changes to it, with private a private channel is created:
+//
+//	:create #name [private]
+func commandCreate(ctx *context.AppContext, args string) {
+	name, option := splitFirstWord(args)
+	name = strings.TrimPrefix(name, "#")
+	if name == "" || (option != "" && option != "private") {
+		showError(ctx, errors.New("usage: :create #name [private]"))
+		return
+	}
+
+	clientID := ctx.View.Channels.GetSelectedClientID()
+	channel, err := ctx.Service.CreateChannel(clientID, name, option == "private")
+	if err != nil {
+		showError(ctx, err)
+		return
+	}
+	actionAddChannel(ctx, channel)
+}
+
+// commandDirectMessage opens a direct message channel with a user of the
+// team of the selected channel and changes to it:
+//
+//	:dm @user
+func commandDirectMessage(ctx *context.AppContext, args string) {
+	userNames := parseUserNames(args)
+	if len(userNames) != 1 {
+		showError(ctx, errors.New("usage: :dm @user"))
+		return
+	}
+	openConversation(ctx, userNames)
+}
+
+// commandGroupMessage opens a multiparty direct message channel with
+// users of the team of the selected channel and changes to it:
+//
+//	:mpdm @user @user...
+func commandGroupMessage(ctx *context.AppContext, args string) {
+	userNames := parseUserNames(args)
+	if len(userNames) < 2 {
+		showError(ctx, errors.New("usage: :mpdm @user @user..."))
+		return
+	}
+	openConversation(ctx, userNames)
+}
+
+// parseUserNames returns the names of the users in args, which may be
+// prefixed with @
+func parseUserNames(args string) []string {
+	var userNames []string
+	for _, name := range strings.Fields(args) {
+		if name = strings.TrimPrefix(name, "@"); name != "" {
+			userNames = append(userNames, name)
+		}
+	}
+	return userNames
+}
+
+// openConversation opens a direct message channel with the users called
+// userNames and changes to it
+func openConversation(ctx *context.AppContext, userNames []string) {
+	clientID := ctx.View.Channels.GetSelectedClientID()
+	channel, err := ctx.Service.OpenConversation(clientID, userNames)
+	if err != nil {
+		showError(ctx, err)
+		return
+	}
+	actionAddChannel(ctx, channel)
+}
+
+// commandJoin changes to a channel of the team of the selected channel,
+// which is joined first when needed:
+//
+//	:join #name
+func commandJoin(ctx *context.AppContext, args string) {
+	name := strings.TrimPrefix(args, "#")
+
+	if channel, ok := findJoinedChannel(ctx, name); ok {
+		ctx.View.Channels.SelectChannel(channel.ID)
+		views.Render(ctx.View.Channels)
+		actionChangeChannel(ctx)
+		return
+	}
+
+	clientID := ctx.View.Channels.GetSelectedClientID()
+	for _, channel := range ctx.Service.GetUnjoinedChannels() {
+		if channel.ClientID != clientID || channel.Name != name {
+			continue
+		}
+
+		joined, err := ctx.Service.JoinChannel(channel.ID)
+		if err != nil {
+			showError(ctx, err)
+			return
+		}
+		actionAddChannel(ctx, joined)
+		return
+	}
+	showError(ctx, fmt.Errorf("no channel called #%s", name))
+}
+
+// commandPart leaves the selected channel, or the channel called name of
+// the same team:
+//
+//	:part [#name]
+func commandPart(ctx *context.AppContext, args string) {
+	channelID := ctx.View.Channels.GetSelectedChannelID()
+	if name := strings.TrimPrefix(args, "#"); name != "" {
+		channel, ok := findJoinedChannel(ctx, name)
+		if !ok {
+			showError(ctx, fmt.Errorf("not a member of #%s", name))
+			return
+		}
+		channelID = channel.ID
+	}
+	leaveChannel(ctx, channelID)
+}
+
+// findJoinedChannel returns the channel or group called name of the team
+// of the selected channel
+func findJoinedChannel(ctx *context.AppContext, name string) (service.Channel, bool) {
+	clientID := ctx.View.Channels.GetSelectedClientID()
+	for _, channel := range ctx.View.Channels.GetChannels() {
+		if channel.ClientID == clientID && channel.ChannelType != service.IM && channel.Name == name {
+			return channel, true
+		}
+	}
+	return service.Channel{}, false
+}
+
+// commandTopic sets the topic of the selected channel, without a topic
+// the topic is cleared:
+//
+//	:topic [topic]
+func commandTopic(ctx *context.AppContext, args string) {
+	channelID := ctx.View.Channels.GetSelectedChannelID()
+	if err := ctx.Service.SetChannelTopic(channelID, args); err != nil {
+		showError(ctx, err)
+		return
+	}
+
+	ctx.View.Chat.SetBorderLabel(
+		ctx.Service.GetChannelName(channelID),
+		ctx.Service.GetChannelTopic(channelID),
+	)
+	views.Render(ctx.View.Chat)
+}
+
+// commandQuit quits the app:
+//
+//	:q
+func commandQuit(ctx *context.AppContext, args string) {
+	actionQuit(ctx)
+}
+
+// commandSet changes one of the settings of settingMap:
+//
+//	:set name=value
+func commandSet(ctx *context.AppContext, args string) {
+	i := strings.Index(args, "=")
+	if i < 0 {
+		showError(ctx, errors.New("usage: :set name=value"))
+		return
+	}
+
+	name := strings.TrimSpace(args[:i])
+	set, ok := settingMap[name]
+	if !ok {
+		showError(ctx, fmt.Errorf("unknown setting %s", name))
+		return
+	}
+	if err := set(ctx, strings.TrimSpace(args[i+1:])); err != nil {
+		showError(ctx, err)
+	}
+}
+
+// setSidebarWidth changes the number of columns of the sidebar, the main
+// pane takes the remaining columns
+func setSidebarWidth(ctx *context.AppContext, value string) error {
+	width, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	if width < 1 || width > 11 {
+		return fmt.Errorf("sidebar_width should be between 1 and 11")
+	}
+
+	ctx.Config.SidebarWidth = width
+	ctx.Config.MainWidth = 12 - width
+	ctx.View.SetWidths(ctx.Config.SidebarWidth, ctx.Config.MainWidth)
+	return nil
+}
+
+// setDownloadDir changes the directory shared files are downloaded to
+func setDownloadDir(ctx *context.AppContext, value string) error {
+	if value == "" {
+		return fmt.Errorf("download_dir can't be empty")
+	}
+
+	ctx.Config.DownloadDir = expandHome(value)
+	return nil
+}
+
+// commandMapKey binds a key, or a sequence of keys, to an action in a
+// mode, like the key_map of the config does:
+//
+//	:map <mode> <keys> <action>
+func commandMapKey(ctx *context.AppContext, args string) {
+	fields := strings.Fields(args)
+	if len(fields) != 3 {
+		showError(ctx, errors.New("usage: :map <mode> <keys> <action>"))
+		return
+	}
+
+	mode, key, action := fields[0], fields[1], fields[2]
+	mapping, ok := ctx.Config.KeyMap[mode]
+	if !ok {
+		showError(ctx, fmt.Errorf("unknown mode %s", mode))
+		return
+	}
+	if _, ok := actionMap[action]; !ok {
+		showError(ctx, fmt.Errorf("unknown action %s", action))
+		return
+	}
+	mapping[key] = action
+	resetKeyTries()
+}
+
+// expandHome replaces the ~/ at the start of path with the home directory
+// of the current user
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if usr, err := user.Current(); err == nil {
+			return usr.HomeDir + path[1:]
+		}
+	}
+	return path
+}
+
+// statusReset clears a status after statusTimeout, unless another status
+// has been shown in its place since
+type statusReset struct {
+	generation int // counts the statuses that have been shown
+}
+
+// schedule runs clear after statusTimeout when no status has been shown
+// since, see cancel
+func (r *statusReset) schedule(ctx *context.AppContext, clear func()) {
+	r.cancel()
+	generation := r.generation
+
+	time.AfterFunc(statusTimeout, func() {
+		ctx.Lock()
+		defer ctx.Unlock()
+		if generation == r.generation {
+			clear()
+		}
+	})
+}
+
+// cancel keeps the status that has been scheduled to be cleared, because
+// another status is shown in its place
+func (r *statusReset) cancel() {
+	r.generation++
+}
+
+// modeReset and errorReset clear the status of the Mode component and the
+// error in the label of the Chat pane
+var modeReset, errorReset statusReset
+
+// showStatus shows status in the Mode component for statusTimeout
+func showStatus(ctx *context.AppContext, status string) {
+	ctx.View.Mode.SetStatus(status)
+	views.Render(ctx.View.Mode)
+
+	modeReset.schedule(ctx, func() {
+		ctx.View.Mode.SetStatus("")
+		views.Render(ctx.View.Mode)
+	})
+}
+
+// showError shows FAILED in the Mode component and err in the label of
+// the Chat pane, which has more room, for statusTimeout
+func showError(ctx *context.AppContext, err error) {
+	ctx.View.Chat.SetError(err.Error())
+	views.Render(ctx.View.Chat)
+	showStatus(ctx, "FAILED")
+
+	errorReset.schedule(ctx, func() {
+		ctx.View.Chat.SetError("")
+		views.Render(ctx.View.Chat)
+	})
+}
+
+// showProgress shows the progress of a transfer of size bytes in the
+// Mode component, prefixed with symbol, e.g. "↑ 45%"
+func showProgress(ctx *context.AppContext, symbol string, size int64) *progress {
+	show := func(percent int) {
+		modeReset.cancel()
+		ctx.View.Mode.SetStatus(fmt.Sprintf("%s %d%%", symbol, percent))
+		views.Render(ctx.View.Mode)
+	}
+	show(0)
+
+	// The transfer runs in a goroutine of its own, see AppContext.Lock
+	return &progress{
+		size: size,
+		report: func(percent int) {
+			ctx.Lock()
+			defer ctx.Unlock()
+			show(percent)
+		},
+	}
+}
+
+// progress reports the percentage of size bytes that has been
+// transferred, every time that percentage changes
+type progress struct {
+	size    int64
+	done    int64
+	percent int
+	report  func(percent int)
+}
+
+// add adds n transferred bytes
+func (p *progress) add(n int) {
+	p.done += int64(n)
+
+	percent := 100
+	if p.size > 0 && p.done < p.size {
+		percent = int(p.done * 100 / p.size)
+	}
+	if percent != p.percent {
+		p.percent = percent
+		p.report(percent)
+	}
+}
+
+// progressReader reads from r and reports the progress of the reads
+type progressReader struct {
+	r io.Reader
+	*progress
+}
+
+// Read implements interface io.Reader
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.add(n)
+	return n, err
+}
+
+// progressWriter writes to w and reports the progress of the writes
+type progressWriter struct {
+	w io.Writer
+	*progress
+}
+
+// Write implements interface io.Writer
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.add(n)
+	return n, err
+}
+
+// limitWriter keeps the first max bytes written to it and discards the
+// rest
+type limitWriter struct {
+	buf bytes.Buffer
+	max int
+}
+
+// Write implements interface io.Writer
+func (l *limitWriter) Write(b []byte) (int, error) {
+	if room := l.max - l.buf.Len(); room > 0 {
+		if len(b) > room {
+			l.buf.Write(b[:room])
+		} else {
+			l.buf.Write(b)
+		}
+	}
+	return len(b), nil
+}
@@ -1,176 +1,449 @@
 package handlers
 
 import (
+	"fmt"
+	"html"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gizak/termui"
-	slack "github.com/nlopes/slack"
 	"github.com/nsf/termbox-go"
 
 	"github.com/jvalduvieco/slack-term/components"
 	"github.com/jvalduvieco/slack-term/context"
+	"github.com/jvalduvieco/slack-term/service"
 	"github.com/jvalduvieco/slack-term/views"
 )
 
+// timer changes to the channel that the cursor was moved to, see
+// changeChannelLater
 var timer *time.Timer
 
+// previewSize is the number of bytes of a file that is downloaded for its
+// preview, which only shows the first lines
+const previewSize = 64 * 1024
+
+// confirmAction is run when the prompt of confirm mode is answered with y,
+// confirmReturnMode is the mode to return to afterwards
+var (
+	confirmAction     func()
+	confirmReturnMode string
+)
+
+// inputAction is run with the text of the Input when it is sent, instead
+// of sending the text as message, see ask
+var inputAction func(string)
+
 // actionMap binds specific action names to the function counterparts,
 // these action names can then be used to bind them to specific keys
 // in the Config.
 var actionMap = map[string]func(*context.AppContext){
-	"space":          actionSpace,
-	"backspace":      actionBackSpace,
-	"delete":         actionDelete,
-	"cursor-right":   actionMoveCursorRight,
-	"cursor-left":    actionMoveCursorLeft,
-	"send":           actionSend,
-	"quit":           actionQuit,
-	"mode-insert":    actionInsertMode,
-	"mode-command":   actionCommandMode,
-	"channel-up":     actionMoveCursorUpChannels,
-	"channel-down":   actionMoveCursorDownChannels,
-	"channel-top":    actionMoveCursorTopChannels,
-	"channel-bottom": actionMoveCursorBottomChannels,
-	"chat-up":        actionScrollUpChat,
-	"chat-down":      actionScrollDownChat,
-	"help":           actionHelp,
+	"space":            actionSpace,
+	"newline":          actionNewline,
+	"backspace":        actionBackSpace,
+	"delete":           actionDelete,
+	"cursor-right":     actionMoveCursorRight,
+	"cursor-left":      actionMoveCursorLeft,
+	"cursor-start":     actionMoveCursorStart,
+	"cursor-end":       actionMoveCursorEnd,
+	"word-right":       actionMoveCursorWordRight,
+	"word-left":        actionMoveCursorWordLeft,
+	"word-backspace":   actionBackSpaceWord,
+	"word-delete":      actionDeleteWord,
+	"kill-line":        actionKillLine,
+	"yank":             actionYank,
+	"undo":             actionUndo,
+	"redo":             actionRedo,
+	"compose":          actionCompose,
+	"compose-send":     actionComposeSend,
+	"send":             actionSend,
+	"quit":             actionQuit,
+	"mode-insert":      actionInsertMode,
+	"mode-command":     actionCommandMode,
+	"channel-up":       actionMoveCursorUpChannels,
+	"channel-down":     actionMoveCursorDownChannels,
+	"channel-top":      actionMoveCursorTopChannels,
+	"channel-bottom":   actionMoveCursorBottomChannels,
+	"chat-up":          actionScrollUpChat,
+	"chat-down":        actionScrollDownChat,
+	"thread-open":      actionOpenThread,
+	"thread-close":     actionCloseThread,
+	"thread-broadcast": actionToggleBroadcast,
+	"thread-up":        actionScrollUpThread,
+	"thread-down":      actionScrollDownThread,
+	"mode-select":      actionSelectMode,
+	"select-up":        actionSelectUp,
+	"select-down":      actionSelectDown,
+	"copy":             actionCopy,
+	"open-link":        actionOpenLink,
+	"file-download":    actionDownloadFile,
+	"file-preview":     actionPreviewFile,
+	"message-edit":     actionEditMessage,
+	"message-delete":   actionDeleteMessage,
+	"react":            actionReact,
+	"help":             actionHelp,
+	"switch-open":      actionOpenSwitcher,
+	"switch-close":     actionCloseSwitcher,
+	"switch-up":        actionSwitcherUp,
+	"switch-down":      actionSwitcherDown,
+	"switch-select":    actionSwitcherSelect,
+	"switch-backspace": actionSwitcherBackspace,
+	"browse-open":      actionOpenBrowser,
+	"browse-close":     actionCloseBrowser,
+	"browse-up":        actionBrowserUp,
+	"browse-down":      actionBrowserDown,
+	"browse-join":      actionBrowserJoin,
+	"browse-backspace": actionBrowserBackspace,
+	"channel-leave":    actionLeaveChannel,
+	"mode-ex":          actionExMode,
+	"ex-run":           actionExRun,
+	"ex-cancel":        actionExCancel,
+	"ex-complete":      actionExComplete,
+	"ex-previous":      actionExPrevious,
+	"ex-next":          actionExNext,
+	"ex-backspace":     actionExBackspace,
 }
 
 // RegisterEventHandlers registers event handlers into the app context
 func RegisterEventHandlers(ctx *context.AppContext) {
 	anyKeyHandler(ctx)
-	for key := range ctx.Service.Client {
-		incomingMessageHandler(ctx, key)
-	}
+	incomingMessageHandler(ctx)
 	termui.Handle("/sys/wnd/resize", resizeHandler(ctx))
 }
 
 func anyKeyHandler(ctx *context.AppContext) {
 	go func() {
+		keys := &keySequence{}
+		escape := &escapeKey{}
 		for {
-			ev := <-ctx.EventQueue
-
-			if ev.Type != termbox.EventKey {
-				continue
-			}
+			select {
+			case ev := <-ctx.EventQueue:
+				if ev.Type != termbox.EventKey {
+					continue
+				}
 
-			keyStr := getKeyString(ev)
-
-			// Get the action name (actionStr) from the key that
-			// has been pressed. If this is found try to uncover
-			// the associated function with this key and execute
-			// it.
-			actionStr, ok := ctx.Config.KeyMap[ctx.Mode][keyStr]
-			if ok {
-				action, ok := actionMap[actionStr]
-				if ok {
-					action(ctx)
+				// Terminals send M-b as escape followed by b, see
+				// escapeKey
+				ctx.Lock()
+				bound := func(alt termbox.Event) bool {
+					return keys.binds(ctx, getKeyString(alt))
 				}
-			} else {
-				if ctx.Mode == context.InsertMode && ev.Ch != 0 {
-					actionInput(ctx.View, ev.Ch)
+				for _, ev := range escape.combine(ev, bound) {
+					handleKey(ctx, keys, ev)
 				}
+				ctx.Unlock()
+			case <-escape.timeout():
+				ctx.Lock()
+				handleKey(ctx, keys, escape.expire())
+				ctx.Unlock()
+			case <-keys.timeout():
+				ctx.Lock()
+				keys.expire(ctx)
+				ctx.Unlock()
 			}
 		}
 	}()
 }
 
+// handleKey runs the action of the key event ev, or types its character
+func handleKey(ctx *context.AppContext, keys *keySequence, ev termbox.Event) {
+	// A prompt is answered with any key, only y confirms
+	if ctx.Mode == context.ConfirmMode {
+		actionConfirm(ctx, ev.Ch == 'y' || ev.Ch == 'Y')
+		return
+	}
+
+	// Look up the key in the key sequences of the mode, see keySequence
+	keys.press(ctx, getKeyString(ev), ev.Ch)
+}
+
+// actionText types a character that isn't bound to an action in the modes
+// that take text
+func actionText(ctx *context.AppContext, ch rune) {
+	switch ctx.Mode {
+	case context.InsertMode, context.ExMode:
+		actionInput(ctx.View, ch)
+	case context.SwitcherMode:
+		actionSwitcherInput(ctx, ch)
+	case context.BrowserMode:
+		actionBrowserInput(ctx, ch)
+	}
+}
+
 func resizeHandler(ctx *context.AppContext) func(termui.Event) {
 	return func(e termui.Event) {
+		ctx.Lock()
+		defer ctx.Unlock()
 		actionResize(ctx)
 	}
 }
 
-func incomingMessageHandler(ctx *context.AppContext, clientID string) {
+// incomingMessageHandler handles the events of the service. They are
+// queued until the handlers let go of the lock, so the service never waits
+// for the handlers, which might in turn wait for the service.
+func incomingMessageHandler(ctx *context.AppContext) {
+	queued := make(chan service.Event)
 	go func() {
-		for {
+		var queue []service.Event
+		events := ctx.Service.IncomingEvents()
+		for events != nil || len(queue) > 0 {
+			// Sending to the nil channel blocks, while nothing is queued
+			var next chan service.Event
+			var first service.Event
+			if len(queue) > 0 {
+				next, first = queued, queue[0]
+			}
+
 			select {
-			case msg := <-ctx.Service.RTM[clientID].IncomingEvents:
-				switch ev := msg.Data.(type) {
-				case *slack.ConnectedEvent:
-					//log.Println("Infos:", ev.Info)
-					markChannelsAsUnread(ev.Info.Channels, ctx.View.Channels)
-				case *slack.MessageEvent:
-
-					// Construct message
-					msg := ctx.Service.CreateMessageFromMessageEvent(ev, clientID)
-
-					// Add message to the selected channel
-					if ev.Channel == ctx.View.Channels.GetSelectedChannelID() {
-
-						// reverse order of messages, mainly done
-						// when attachments are added to message
-						for i := len(msg) - 1; i >= 0; i-- {
-							ctx.View.Chat.AddMessage(msg[i])
-						}
-
-						termui.Render(ctx.View.Chat)
-
-						// TODO: set Chat.offset to 0, to automatically scroll
-						// down?
-					}
-
-					// Set new message indicator for channel, I'm leaving
-					// this here because I also want to be notified when
-					// I'm currently in a channel but not in the terminal
-					// window (tmux). But only create a notification when
-					// it comes from someone else but the current user.
-					if ev.User != ctx.Service.GetCurrentUserID(clientID) {
-						actionNewMessage(ctx, ev.Channel)
-					}
-				default:
-					//log.Printf("Unhandled Event: %v\n", msg.Data)
+			case msg, ok := <-events:
+				if !ok {
+					events = nil
+					continue
 				}
-
+				queue = append(queue, msg)
+			case next <- first:
+				queue = queue[1:]
 			}
 		}
+		close(queued)
+	}()
+
+	go func() {
+		for msg := range queued {
+			ctx.Lock()
+			handleIncomingEvent(ctx, msg)
+			ctx.Unlock()
+		}
 	}()
 }
-func markChannelsAsUnread(channels []slack.Channel, channelsView *components.Channels) {
-	for _, chn := range channels {
-		if chn.UnreadCountDisplay > 0 {
-			channelsView.MarkAsUnread(chn.ID)
+
+// handleIncomingEvent updates the widgets for an event of the service
+func handleIncomingEvent(ctx *context.AppContext, msg service.Event) {
+	switch ev := msg.Data.(type) {
+	case *service.ConnectedEvent:
+		markChannelsAsUnread(ev.UnreadChannelIDs, ctx.View.Channels)
+	case *service.MessageEvent:
+
+		// Add replies to the open thread
+		if ctx.View.Thread.IsShowing(ev.ChannelID, ev.Message.ThreadTimestamp) {
+			ctx.View.Thread.AddMessage(ev.Message)
+			views.Render(ctx.View.Thread)
+		}
+
+		// Add message to the selected channel, thread replies
+		// only show up as reply count of their parent
+		if ev.ChannelID == ctx.View.Channels.GetSelectedChannelID() &&
+			!ev.Message.IsThreadReply() {
+			ctx.View.Chat.AddMessage(ev.Message)
+			views.Render(ctx.View.Chat)
+
+			// TODO: set Chat.offset to 0, to automatically scroll
+			// down?
+		}
+
+		// Set new message indicator for channel, I'm leaving
+		// this here because I also want to be notified when
+		// I'm currently in a channel but not in the terminal
+		// window (tmux). But only create a notification when
+		// it comes from someone else but the current user.
+		if ev.UserID != ctx.Service.GetCurrentUserID(msg.ClientID) {
+			actionNewMessage(ctx, ev.ChannelID)
+		}
+	case *service.MessageChangedEvent:
+		if ev.ChannelID == ctx.View.Channels.GetSelectedChannelID() {
+			ctx.View.Chat.UpdateMessage(ev.Message)
+			views.Render(ctx.View.Chat)
+		}
+		if ev.ChannelID == ctx.View.Thread.GetChannelID() {
+			ctx.View.Thread.UpdateMessage(ev.Message)
+			views.Render(ctx.View.Thread)
+		}
+	case *service.ReactionAddedEvent:
+		if ev.ChannelID == ctx.View.Channels.GetSelectedChannelID() {
+			ctx.View.Chat.AddReaction(ev.Timestamp, ev.Name, ev.UserID)
+			views.Render(ctx.View.Chat)
+		}
+		if ev.ChannelID == ctx.View.Thread.GetChannelID() {
+			ctx.View.Thread.AddReaction(ev.Timestamp, ev.Name, ev.UserID)
+			views.Render(ctx.View.Thread)
+		}
+	case *service.ReactionRemovedEvent:
+		if ev.ChannelID == ctx.View.Channels.GetSelectedChannelID() {
+			ctx.View.Chat.RemoveReaction(ev.Timestamp, ev.Name, ev.UserID)
+			views.Render(ctx.View.Chat)
+		}
+		if ev.ChannelID == ctx.View.Thread.GetChannelID() {
+			ctx.View.Thread.RemoveReaction(ev.Timestamp, ev.Name, ev.UserID)
+			views.Render(ctx.View.Thread)
+		}
+	case *service.MessageDeletedEvent:
+		if ev.ChannelID == ctx.View.Channels.GetSelectedChannelID() {
+			ctx.View.Chat.DeleteMessage(ev.Timestamp)
+			views.Render(ctx.View.Chat)
+		}
+		if ev.ChannelID == ctx.View.Thread.GetChannelID() {
+			ctx.View.Thread.DeleteMessage(ev.Timestamp)
+			views.Render(ctx.View.Thread)
+		}
+	case *service.CustomEmojiEvent:
+		if msg.ClientID == ctx.View.Channels.GetSelectedClientID() {
+			ctx.View.Chat.SetCustomEmoji(ev.Emoji)
+			views.Render(ctx.View.Chat)
+
+			if ctx.View.Thread.IsOpen() {
+				ctx.View.Thread.SetCustomEmoji(ev.Emoji)
+				views.Render(ctx.View.Thread)
+			}
 		}
+	case *service.ErrorEvent:
+		showError(ctx, ev.Err)
+	default:
+		//log.Printf("Unhandled Event: %v\n", msg.Data)
+	}
+
+	// Keep the Switcher on top of the widgets that changed
+	if ctx.View.Switcher.IsOpen() {
+		views.Render(ctx.View.Switcher)
+	}
+	if ctx.View.Browser.IsOpen() {
+		views.Render(ctx.View.Browser)
 	}
 }
 
-// FIXME: resize only seems to work for width and resizing it too small
-// will cause termui to panic
+func markChannelsAsUnread(channelIDs []string, channelsView *components.Channels) {
+	for _, channelID := range channelIDs {
+		channelsView.MarkAsUnread(channelID)
+	}
+}
+
+// FIXME: resizing it too small will cause termui to panic
 func actionResize(ctx *context.AppContext) {
-	_ = ctx
-	termui.Body.Width = termui.TermWidth()
-	termui.Body.Align()
-	termui.Render(termui.Body)
+	ctx.View.Resize()
 }
 
 func actionInput(view *views.View, key rune) {
 	view.Input.Insert(key)
-	termui.Render(view.Input)
+	view.RenderInput()
 }
 
 func actionSpace(ctx *context.AppContext) {
 	actionInput(ctx.View, ' ')
 }
 
+// actionNewline starts a new line in the Input, the message is sent with
+// actionSend
+func actionNewline(ctx *context.AppContext) {
+	actionInput(ctx.View, '\n')
+}
+
 func actionBackSpace(ctx *context.AppContext) {
 	ctx.View.Input.Backspace()
-	termui.Render(ctx.View.Input)
+	ctx.View.RenderInput()
 }
 
 func actionDelete(ctx *context.AppContext) {
 	ctx.View.Input.Delete()
-	termui.Render(ctx.View.Input)
+	ctx.View.RenderInput()
 }
 
 func actionMoveCursorRight(ctx *context.AppContext) {
 	ctx.View.Input.MoveCursorRight()
-	termui.Render(ctx.View.Input)
+	ctx.View.RenderInput()
 }
 
 func actionMoveCursorLeft(ctx *context.AppContext) {
 	ctx.View.Input.MoveCursorLeft()
-	termui.Render(ctx.View.Input)
+	ctx.View.RenderInput()
+}
+
+func actionMoveCursorStart(ctx *context.AppContext) {
+	ctx.View.Input.MoveCursorStart()
+	ctx.View.RenderInput()
+}
+
+func actionMoveCursorEnd(ctx *context.AppContext) {
+	ctx.View.Input.MoveCursorEnd()
+	ctx.View.RenderInput()
+}
+
+func actionMoveCursorWordRight(ctx *context.AppContext) {
+	ctx.View.Input.MoveCursorWordRight()
+	ctx.View.RenderInput()
+}
+
+func actionMoveCursorWordLeft(ctx *context.AppContext) {
+	ctx.View.Input.MoveCursorWordLeft()
+	ctx.View.RenderInput()
+}
+
+func actionBackSpaceWord(ctx *context.AppContext) {
+	ctx.View.Input.BackspaceWord()
+	ctx.View.RenderInput()
+}
+
+func actionDeleteWord(ctx *context.AppContext) {
+	ctx.View.Input.DeleteWord()
+	ctx.View.RenderInput()
+}
+
+// actionKillLine removes the text after the cursor of the Input, it can
+// be inserted again with actionYank
+func actionKillLine(ctx *context.AppContext) {
+	ctx.View.Input.KillLine()
+	ctx.View.RenderInput()
+}
+
+func actionYank(ctx *context.AppContext) {
+	ctx.View.Input.Yank()
+	ctx.View.RenderInput()
+}
+
+func actionUndo(ctx *context.AppContext) {
+	ctx.View.Input.Undo()
+	ctx.View.RenderInput()
+}
+
+func actionRedo(ctx *context.AppContext) {
+	ctx.View.Input.Redo()
+	ctx.View.RenderInput()
+}
+
+// actionCompose opens the text of the Input in the editor of the user, the
+// text is loaded into the Input when the editor exits
+func actionCompose(ctx *context.AppContext) {
+	if compose(ctx) && ctx.Mode == context.CommandMode {
+		actionInsertMode(ctx)
+	}
+}
+
+// actionComposeSend opens the text of the Input in the editor of the user,
+// like actionCompose, and sends the text when the editor exits
+func actionComposeSend(ctx *context.AppContext) {
+	if compose(ctx) {
+		actionSend(ctx)
+	}
+}
+
+// compose edits the text of the Input in the editor of the user and
+// returns true when it has been saved. An editor that fails, like vim
+// after :cq, leaves the Input untouched.
+func compose(ctx *context.AppContext) bool {
+	text, err := editText(ctx.Suspend, ctx.View.Input.GetText())
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			showError(ctx, err)
+		}
+		return false
+	}
+
+	// Editors end the last line with a newline
+	ctx.View.Input.SetText(strings.TrimRight(text, "\n"))
+	ctx.View.RenderInput()
+	return true
 }
 
 func actionSend(ctx *context.AppContext) {
@@ -182,6 +455,29 @@ func actionSend(ctx *context.AppContext) {
 		ctx.View.Input.Clear()
 		ctx.View.Refresh()
 
+		// The input was asked for, see ask
+		if inputAction != nil {
+			action := inputAction
+			inputAction = nil
+			action(message)
+			return
+		}
+
+		// Commands, like :upload, are run instead of sent
+		if runCommand(ctx, message) {
+			return
+		}
+
+		// When a thread is open the message is a reply
+		if ctx.View.Thread.IsOpen() {
+			ctx.Service.SendReply(
+				ctx.View.Thread.GetChannelID(),
+				ctx.View.Thread.GetThreadTimestamp(),
+				message,
+				ctx.View.Thread.IsBroadcast())
+			return
+		}
+
 		ctx.Service.SendMessage(
 			ctx.View.Channels.GetSelectedChannelID(),
 			message)
@@ -196,97 +492,713 @@ func actionQuit(ctx *context.AppContext) {
 func actionInsertMode(ctx *context.AppContext) {
 	ctx.Mode = context.InsertMode
 	ctx.View.Mode.SetText("INSERT")
-	termui.Render(ctx.View.Mode)
+	views.Render(ctx.View.Mode)
 }
 
 func actionCommandMode(ctx *context.AppContext) {
 	ctx.Mode = context.CommandMode
 	ctx.View.Mode.SetText("COMMAND")
-	termui.Render(ctx.View.Mode)
+	views.Render(ctx.View.Mode)
+
+	// Leaving insert mode abandons a question
+	cancelAsk(ctx)
+
+	ctx.View.Chat.ClearSelection()
+	views.Render(ctx.View.Chat)
 }
 
-func actionMoveCursorUpChannels(ctx *context.AppContext) {
-	go func() {
-		if timer != nil {
-			timer.Stop()
-		}
+// actionSelectMode highlights the newest message of the Chat pane, the
+// highlight can then be moved message by message
+func actionSelectMode(ctx *context.AppContext) {
+	ctx.Mode = context.SelectMode
+	ctx.View.Mode.SetText("SELECT")
+	views.Render(ctx.View.Mode)
+
+	ctx.View.Chat.SelectNext()
+	views.Render(ctx.View.Chat)
+}
 
+func actionMoveCursorUpChannels(ctx *context.AppContext) {
+	count := repeatCount(ctx)
+	for i := 0; i < count; i++ {
 		ctx.View.Channels.MoveCursorUp()
-		termui.Render(ctx.View.Channels)
+	}
+	views.Render(ctx.View.Channels)
 
-		timer = time.NewTimer(time.Second / 4)
-		<-timer.C
+	changeChannelLater(ctx)
+}
+
+// changeChannelLater changes to the selected channel after a moment, so
+// moving the cursor over several channels only loads the last one
+func changeChannelLater(ctx *context.AppContext) {
+	if timer != nil {
+		timer.Stop()
+	}
 
+	timer = time.AfterFunc(time.Second/4, func() {
+		ctx.Lock()
+		defer ctx.Unlock()
 		actionChangeChannel(ctx)
-	}()
+	})
 }
 
 func actionMoveCursorDownChannels(ctx *context.AppContext) {
-	go func() {
-		if timer != nil {
-			timer.Stop()
-		}
-
+	count := repeatCount(ctx)
+	for i := 0; i < count; i++ {
 		ctx.View.Channels.MoveCursorDown()
-		termui.Render(ctx.View.Channels)
-
-		timer = time.NewTimer(time.Second / 4)
-		<-timer.C
+	}
+	views.Render(ctx.View.Channels)
 
-		actionChangeChannel(ctx)
-	}()
+	changeChannelLater(ctx)
 }
 
+// actionMoveCursorTopChannels moves the cursor to the first channel, or
+// to the channel at the count typed before it, like 5g
 func actionMoveCursorTopChannels(ctx *context.AppContext) {
-	ctx.View.Channels.MoveCursorTop()
+	if !moveCursorToCount(ctx) {
+		ctx.View.Channels.MoveCursorTop()
+	}
 	actionChangeChannel(ctx)
 }
 
+// actionMoveCursorBottomChannels moves the cursor to the last channel, or
+// to the channel at the count typed before it, like 5G
 func actionMoveCursorBottomChannels(ctx *context.AppContext) {
-	ctx.View.Channels.MoveCursorBottom()
+	if !moveCursorToCount(ctx) {
+		ctx.View.Channels.MoveCursorBottom()
+	}
 	actionChangeChannel(ctx)
 }
 
+// moveCursorToCount moves the cursor to the channel at position count,
+// the first channel being 1. It returns false when no count has been
+// typed.
+func moveCursorToCount(ctx *context.AppContext) bool {
+	channels := ctx.View.Channels.GetChannels()
+	if ctx.Count == 0 || len(channels) == 0 {
+		return false
+	}
+
+	index := ctx.Count - 1
+	if index >= len(channels) {
+		index = len(channels) - 1
+	}
+	ctx.View.Channels.SelectChannel(channels[index].ID)
+	views.Render(ctx.View.Channels)
+	return true
+}
+
 func actionChangeChannel(ctx *context.AppContext) {
-	// Clear messages from Chat pane
-	ctx.View.Chat.ClearMessages()
+	channelID := ctx.View.Channels.GetSelectedChannelID()
+	ctx.View.Channels.MarkAsVisited(channelID)
+
+	// A thread belongs to the channel it was opened in, and so does
+	// a question about one of its messages
+	ctx.View.CloseThread()
+	cancelAsk(ctx)
 
-	// Get message for the new channel
+	// Show the cached messages of the new channel right away
+	ctx.View.Chat.ClearMessages()
 	ctx.View.Chat.AddMessages(
-		ctx.Service.GetMessages(
-			ctx.View.Channels.GetSelectedChannelID(),
+		ctx.Service.GetCachedMessages(
+			channelID,
 			ctx.View.Chat.GetMaxNumberOfMessagesVisible()))
 
 	// Set channel name for the Chat pane
 	ctx.View.Chat.SetBorderLabel(
-		ctx.Service.GetChannelName(ctx.View.Channels.GetSelectedChannelID()),
-		ctx.Service.GetChannelTopic(ctx.View.Channels.GetSelectedChannelID()),
+		ctx.Service.GetChannelName(channelID),
+		ctx.Service.GetChannelTopic(channelID),
 	)
+	views.Render(ctx.View.Chat)
+
+	// Messages are rendered for the team of the channel, its custom
+	// emoji are only fetched once
+	clientID := ctx.View.Channels.GetSelectedClientID()
+	ctx.View.Chat.SetCustomEmoji(ctx.Service.GetCustomEmoji(clientID))
+	ctx.View.Chat.SetCurrentUserID(ctx.Service.GetCurrentUserID(clientID))
+
+	// Get the messages we've missed for the new channel
+	messages := ctx.Service.GetMessages(
+		channelID,
+		ctx.View.Chat.GetMaxNumberOfMessagesVisible())
+
+	// Bail out when the user has moved on to another channel
+	if channelID != ctx.View.Channels.GetSelectedChannelID() {
+		return
+	}
+	ctx.View.Chat.ClearMessages()
+	ctx.View.Chat.AddMessages(messages)
 
 	// Set read mark
 	ctx.Service.SetChannelReadMark(ctx.View.Channels.GetSelectedChannelID())
-	termui.Render(ctx.View.Channels)
-	termui.Render(ctx.View.Chat)
+	views.Render(ctx.View.Channels)
+	views.Render(ctx.View.Chat)
+}
+
+// actionOpenSwitcher opens the Switcher, to switch to a channel of any
+// team by typing part of its name
+func actionOpenSwitcher(ctx *context.AppContext) {
+	ctx.Mode = context.SwitcherMode
+	ctx.View.Mode.SetText("SWITCH")
+	views.Render(ctx.View.Mode)
+
+	ctx.View.OpenSwitcher()
+}
+
+func actionCloseSwitcher(ctx *context.AppContext) {
+	ctx.View.CloseSwitcher()
+	actionCommandMode(ctx)
+}
+
+func actionSwitcherInput(ctx *context.AppContext, key rune) {
+	ctx.View.Switcher.Insert(key)
+	views.Render(ctx.View.Switcher)
+}
+
+func actionSwitcherBackspace(ctx *context.AppContext) {
+	ctx.View.Switcher.Backspace()
+	views.Render(ctx.View.Switcher)
+}
+
+func actionSwitcherUp(ctx *context.AppContext) {
+	ctx.View.Switcher.SelectPrevious()
+	views.Render(ctx.View.Switcher)
+}
+
+func actionSwitcherDown(ctx *context.AppContext) {
+	ctx.View.Switcher.SelectNext()
+	views.Render(ctx.View.Switcher)
+}
+
+// actionSwitcherSelect closes the Switcher and changes to the highlighted
+// channel, like moving the cursor of the Channels list does
+func actionSwitcherSelect(ctx *context.AppContext) {
+	channel, ok := ctx.View.Switcher.GetSelectedChannel()
+	actionCloseSwitcher(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.View.Channels.SelectChannel(channel.ID)
+	views.Render(ctx.View.Channels)
+	actionChangeChannel(ctx)
+}
+
+// actionOpenBrowser opens the Browser, to join a channel of any team by
+// typing part of its name
+func actionOpenBrowser(ctx *context.AppContext) {
+	ctx.Mode = context.BrowserMode
+	ctx.View.Mode.SetText("BROWSE")
+	views.Render(ctx.View.Mode)
+
+	ctx.View.OpenBrowser(ctx.Service.GetUnjoinedChannels())
+}
+
+func actionCloseBrowser(ctx *context.AppContext) {
+	ctx.View.CloseBrowser()
+	actionCommandMode(ctx)
+}
+
+func actionBrowserInput(ctx *context.AppContext, key rune) {
+	ctx.View.Browser.Insert(key)
+	views.Render(ctx.View.Browser)
+}
+
+func actionBrowserBackspace(ctx *context.AppContext) {
+	ctx.View.Browser.Backspace()
+	views.Render(ctx.View.Browser)
+}
+
+func actionBrowserUp(ctx *context.AppContext) {
+	ctx.View.Browser.SelectPrevious()
+	views.Render(ctx.View.Browser)
+}
+
+func actionBrowserDown(ctx *context.AppContext) {
+	ctx.View.Browser.SelectNext()
+	views.Render(ctx.View.Browser)
+}
+
+// actionBrowserJoin closes the Browser and joins the highlighted channel,
+// which is added to the Channels list and changed to
+func actionBrowserJoin(ctx *context.AppContext) {
+	channel, ok := ctx.View.Browser.GetSelectedChannel()
+	actionCloseBrowser(ctx)
+	if !ok {
+		return
+	}
+
+	joined, err := ctx.Service.JoinChannel(channel.ID)
+	if err != nil {
+		showError(ctx, err)
+		return
+	}
+	actionAddChannel(ctx, joined)
+}
+
+// actionAddChannel adds a channel that has been joined, created or
+// opened to the Channels list and changes to it
+func actionAddChannel(ctx *context.AppContext, channel service.Channel) {
+	ctx.View.Channels.AddChannel(channel)
+	ctx.View.Channels.SelectChannel(channel.ID)
+	views.Render(ctx.View.Channels)
+	actionChangeChannel(ctx)
+}
+
+// actionLeaveChannel leaves the selected channel after confirmation, it
+// is removed from the Channels list. Only public channels can be left.
+func actionLeaveChannel(ctx *context.AppContext) {
+	channelID := ctx.View.Channels.GetSelectedChannelID()
+	name := ctx.Service.GetChannelName(channelID)
+
+	prompt(ctx, fmt.Sprintf("Leave #%s?", name), func() {
+		leaveChannel(ctx, channelID)
+	})
+}
+
+// leaveChannel leaves the channel and removes it from the Channels list,
+// when it was the selected channel the next channel is changed to
+func leaveChannel(ctx *context.AppContext, channelID string) {
+	if err := ctx.Service.LeaveChannel(channelID); err != nil {
+		showError(ctx, err)
+		return
+	}
+
+	selected := ctx.View.Channels.GetSelectedChannelID() == channelID
+	ctx.View.Channels.RemoveChannel(channelID)
+	views.Render(ctx.View.Channels)
+	if selected {
+		actionChangeChannel(ctx)
+	}
 }
 
 func actionNewMessage(ctx *context.AppContext, channelID string) {
 	ctx.View.Channels.MarkAsUnread(channelID)
-	termui.Render(ctx.View.Channels)
+	views.Render(ctx.View.Channels)
 }
 
 func actionScrollUpChat(ctx *context.AppContext) {
-	ctx.View.Chat.ScrollUp()
-	termui.Render(ctx.View.Chat)
+	for i := 0; i < repeatCount(ctx); i++ {
+		ctx.View.Chat.ScrollUp()
+	}
+	views.Render(ctx.View.Chat)
+
+	if ctx.View.Chat.NeedsOlderMessages() {
+		actionLoadOlderMessages(ctx)
+	}
+}
+
+// actionLoadOlderMessages fetches the page of messages preceding the oldest
+// message in the Chat pane, while the page is in flight a marker is shown
+// on top of the Chat pane.
+func actionLoadOlderMessages(ctx *context.AppContext) {
+	channelID := ctx.View.Channels.GetSelectedChannelID()
+
+	ctx.View.Chat.SetLoading(true)
+	views.Render(ctx.View.Chat)
+
+	count := ctx.View.Chat.GetMaxNumberOfMessagesVisible()
+	go func() {
+		messages, err := ctx.Service.GetOlderMessages(channelID, count)
+
+		ctx.Lock()
+		defer ctx.Unlock()
+
+		// Bail out when the user has moved on to another channel
+		if channelID != ctx.View.Channels.GetSelectedChannelID() {
+			return
+		}
+
+		ctx.View.Chat.SetLoading(false)
+		if err == nil {
+			if len(messages) == 0 {
+				ctx.View.Chat.SetHistoryComplete()
+			}
+			ctx.View.Chat.PrependMessages(messages)
+		}
+		views.Render(ctx.View.Chat)
+	}()
 }
 
 func actionScrollDownChat(ctx *context.AppContext) {
-	ctx.View.Chat.ScrollDown()
-	termui.Render(ctx.View.Chat)
+	for i := 0; i < repeatCount(ctx); i++ {
+		ctx.View.Chat.ScrollDown()
+	}
+	views.Render(ctx.View.Chat)
+}
+
+// actionOpenThread opens the Thread pane on the thread parent of the Chat
+// pane, see Chat.GetThreadParent
+func actionOpenThread(ctx *context.AppContext) {
+	parent, ok := ctx.View.Chat.GetThreadParent()
+	if !ok {
+		return
+	}
+
+	// A reply that was broadcast to the channel opens the thread it
+	// belongs to
+	threadTimestamp := parent.Timestamp
+	if parent.ThreadTimestamp != "" {
+		threadTimestamp = parent.ThreadTimestamp
+	}
+
+	channelID := ctx.View.Channels.GetSelectedChannelID()
+	clientID := ctx.View.Channels.GetSelectedClientID()
+	go func() {
+		messages, err := ctx.Service.GetThreadReplies(channelID, threadTimestamp)
+		if err != nil {
+			return
+		}
+
+		ctx.Lock()
+		defer ctx.Unlock()
+
+		// Bail out when the user has moved on to another channel
+		if channelID != ctx.View.Channels.GetSelectedChannelID() {
+			return
+		}
+		ctx.View.Thread.SetCustomEmoji(ctx.Service.GetCustomEmoji(clientID))
+		ctx.View.Thread.SetCurrentUserID(ctx.Service.GetCurrentUserID(clientID))
+		ctx.View.OpenThread(channelID, threadTimestamp, messages)
+	}()
+}
+
+func actionCloseThread(ctx *context.AppContext) {
+	ctx.View.CloseThread()
+}
+
+func actionScrollUpThread(ctx *context.AppContext) {
+	if !ctx.View.Thread.IsOpen() {
+		return
+	}
+
+	for i := 0; i < repeatCount(ctx); i++ {
+		ctx.View.Thread.ScrollUp()
+	}
+	views.Render(ctx.View.Thread)
+}
+
+func actionScrollDownThread(ctx *context.AppContext) {
+	if !ctx.View.Thread.IsOpen() {
+		return
+	}
+
+	for i := 0; i < repeatCount(ctx); i++ {
+		ctx.View.Thread.ScrollDown()
+	}
+	views.Render(ctx.View.Thread)
+}
+
+// actionToggleBroadcast toggles whether replies in the open thread are
+// sent to the channel as well
+func actionToggleBroadcast(ctx *context.AppContext) {
+	if !ctx.View.Thread.IsOpen() {
+		return
+	}
+
+	ctx.View.Thread.ToggleBroadcast()
+	views.Render(ctx.View.Thread)
+}
+
+func actionSelectUp(ctx *context.AppContext) {
+	for i := 0; i < repeatCount(ctx); i++ {
+		ctx.View.Chat.SelectPrevious()
+	}
+	views.Render(ctx.View.Chat)
+
+	if ctx.View.Chat.NeedsOlderMessages() {
+		actionLoadOlderMessages(ctx)
+	}
+}
+
+func actionSelectDown(ctx *context.AppContext) {
+	for i := 0; i < repeatCount(ctx); i++ {
+		ctx.View.Chat.SelectNext()
+	}
+	views.Render(ctx.View.Chat)
+}
+
+// actionCopy copies the text of the highlighted message to the clipboard
+func actionCopy(ctx *context.AppContext) {
+	message, ok := ctx.View.Chat.GetSelectedMessage()
+	if !ok || message.Deleted {
+		return
+	}
+
+	text := html.UnescapeString(message.Text)
+	go func() {
+		err := copyToClipboard(text)
+
+		ctx.Lock()
+		defer ctx.Unlock()
+		if err != nil {
+			showError(ctx, err)
+		}
+	}()
+}
+
+// actionOpenLink opens the first link of the highlighted message
+func actionOpenLink(ctx *context.AppContext) {
+	message, ok := ctx.View.Chat.GetSelectedMessage()
+	if !ok || message.Deleted {
+		return
+	}
+
+	links := message.Links()
+	if len(links) == 0 {
+		return
+	}
+	if err := openURL(html.UnescapeString(links[0])); err != nil {
+		showError(ctx, err)
+	}
+}
+
+// actionDownloadFile downloads the first file shared in the highlighted
+// message to the download directory, the progress of the download is
+// shown in the Mode component. Existing files are not overwritten.
+func actionDownloadFile(ctx *context.AppContext) {
+	file, ok := getSelectedFile(ctx)
+	if !ok {
+		return
+	}
+
+	path, err := createDownloadPath(ctx.Config.DownloadDir, file)
+	if err != nil {
+		showError(ctx, err)
+		return
+	}
+
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		showError(ctx, err)
+		return
+	}
+
+	writer := &progressWriter{
+		w:        out,
+		progress: showProgress(ctx, "↓", int64(file.Size)),
+	}
+
+	channelID := ctx.View.Channels.GetSelectedChannelID()
+	go func() {
+		err := ctx.Service.DownloadFile(channelID, file, writer)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+
+		ctx.Lock()
+		defer ctx.Unlock()
+		if err != nil {
+			os.Remove(path)
+			showError(ctx, err)
+			return
+		}
+		showStatus(ctx, "SAVED")
+	}()
+}
+
+// createDownloadPath returns the path in dir to download file to, which is
+// made unique by numbering it, e.g. build (1).log. dir is created when it
+// doesn't exist.
+func createDownloadPath(dir string, file service.File) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	name := filepath.Base(file.Name)
+	if name == "." || name == string(filepath.Separator) {
+		name = file.ID
+	}
+
+	path := filepath.Join(dir, name)
+	ext := filepath.Ext(name)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path, nil
+		}
+		path = filepath.Join(dir, fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), i, ext))
+	}
+}
+
+// actionPreviewFile shows or hides the preview of the first file shared
+// in the highlighted message, only text files can be previewed
+func actionPreviewFile(ctx *context.AppContext) {
+	file, ok := getSelectedFile(ctx)
+	if !ok || !file.IsText() {
+		return
+	}
+
+	if ctx.View.Chat.HasFilePreview(file.ID) {
+		ctx.View.Chat.ClearFilePreview(file.ID)
+		views.Render(ctx.View.Chat)
+		return
+	}
+
+	channelID := ctx.View.Channels.GetSelectedChannelID()
+	go func() {
+		content := &limitWriter{max: previewSize}
+		err := ctx.Service.DownloadFile(channelID, file, content)
+
+		ctx.Lock()
+		defer ctx.Unlock()
+		if err != nil {
+			showError(ctx, err)
+			return
+		}
+
+		// Bail out when the user has moved on to another channel
+		if channelID != ctx.View.Channels.GetSelectedChannelID() {
+			return
+		}
+		ctx.View.Chat.SetFilePreview(file.ID, content.buf.String())
+		views.Render(ctx.View.Chat)
+	}()
+}
+
+// getSelectedFile returns the first file shared in the highlighted message
+func getSelectedFile(ctx *context.AppContext) (service.File, bool) {
+	message, ok := ctx.View.Chat.GetSelectedMessage()
+	if !ok || message.Deleted || len(message.Files) == 0 {
+		return service.File{}, false
+	}
+	return message.Files[0], true
+}
+
+// actionEditMessage loads the text of the highlighted message into the
+// Input, sending it will save the changes. Only messages of the current
+// user can be edited.
+func actionEditMessage(ctx *context.AppContext) {
+	message, ok := ctx.View.Chat.GetSelectedMessage()
+	if !ok || !isOwnMessage(ctx, message) {
+		return
+	}
+
+	channelID := ctx.View.Channels.GetSelectedChannelID()
+	ctx.View.Input.SetText(html.UnescapeString(message.Text))
+	ask(ctx, "Edit message", func(text string) {
+		ctx.View.Chat.ClearSelection()
+		views.Render(ctx.View.Chat)
+
+		if err := ctx.Service.UpdateMessage(channelID, message.Timestamp, text); err != nil {
+			showError(ctx, err)
+		}
+	})
+}
+
+// actionReact asks for the name of a reaction and toggles the reaction of
+// the current user on the highlighted message
+func actionReact(ctx *context.AppContext) {
+	message, ok := ctx.View.Chat.GetSelectedMessage()
+	if !ok || message.Deleted {
+		return
+	}
+
+	question := "Toggle reaction"
+	if len(message.Reactions) > 0 {
+		var names []string
+		for _, reaction := range message.Reactions {
+			names = append(names, reaction.Name)
+		}
+		question = fmt.Sprintf("Toggle reaction (%s)", strings.Join(names, ", "))
+	}
+
+	channelID := ctx.View.Channels.GetSelectedChannelID()
+	userID := ctx.Service.GetCurrentUserID(ctx.View.Channels.GetSelectedClientID())
+	ask(ctx, question, func(text string) {
+		name := strings.Trim(strings.TrimSpace(text), ":")
+		if name == "" {
+			return
+		}
+
+		for _, reaction := range message.Reactions {
+			if reaction.Name == name && reaction.HasUser(userID) {
+				if err := ctx.Service.RemoveReaction(channelID, message.Timestamp, name); err != nil {
+					showError(ctx, err)
+				}
+				return
+			}
+		}
+		if err := ctx.Service.AddReaction(channelID, message.Timestamp, name); err != nil {
+			showError(ctx, err)
+		}
+	})
+}
+
+// actionDeleteMessage deletes the highlighted message after confirmation.
+// Only messages of the current user can be deleted.
+func actionDeleteMessage(ctx *context.AppContext) {
+	message, ok := ctx.View.Chat.GetSelectedMessage()
+	if !ok || !isOwnMessage(ctx, message) {
+		return
+	}
+
+	channelID := ctx.View.Channels.GetSelectedChannelID()
+	prompt(ctx, "Delete this message?", func() {
+		if err := ctx.Service.DeleteMessage(channelID, message.Timestamp); err != nil {
+			showError(ctx, err)
+		}
+	})
+}
+
+// isOwnMessage returns true when message was sent by the current user
+func isOwnMessage(ctx *context.AppContext, message service.Message) bool {
+	clientID := ctx.View.Channels.GetSelectedClientID()
+	return !message.Deleted && message.UserID == ctx.Service.GetCurrentUserID(clientID)
+}
+
+// ask shows question above the Input and switches to insert mode, the
+// text that is sent will be passed to action instead of being sent as
+// message
+func ask(ctx *context.AppContext, question string, action func(string)) {
+	inputAction = action
+	ctx.View.Input.SetBorderLabel(question)
+	ctx.View.RenderInput()
+
+	actionInsertMode(ctx)
+}
+
+// cancelAsk abandons the question asked with ask
+func cancelAsk(ctx *context.AppContext) {
+	if inputAction == nil {
+		return
+	}
+
+	inputAction = nil
+	ctx.View.Input.Clear()
+	ctx.View.RenderInput()
+}
+
+// prompt shows question in the Input and switches to confirm mode, when
+// the question is answered with y action will be run
+func prompt(ctx *context.AppContext, question string, action func()) {
+	confirmAction = action
+	confirmReturnMode = ctx.Mode
+
+	ctx.Mode = context.ConfirmMode
+	ctx.View.Mode.SetText("CONFIRM")
+	ctx.View.Input.SetBorderLabel(fmt.Sprintf("%s (y/n)", question))
+	views.Render(ctx.View.Mode, ctx.View.Input)
+}
+
+// actionConfirm answers the prompt of confirm mode and returns to the mode
+// the prompt was shown in
+func actionConfirm(ctx *context.AppContext, confirmed bool) {
+	action := confirmAction
+	confirmAction = nil
+
+	ctx.Mode = confirmReturnMode
+	ctx.View.Mode.SetText(strings.ToUpper(confirmReturnMode))
+	ctx.View.Input.SetBorderLabel("")
+	views.Render(ctx.View.Mode, ctx.View.Input)
+
+	if confirmed && action != nil {
+		action()
+	}
 }
 
 func actionHelp(ctx *context.AppContext) {
 	ctx.View.Chat.ShowHelp(ctx.Config)
-	termui.Render(ctx.View.Chat)
+	views.Render(ctx.View.Chat)
 }
 
 // GetKeyString will return a string that resembles the key event from
@@ -316,7 +1228,7 @@ func getKeyString(e termbox.Event) string {
 
 		if e.Key <= 0x7F {
 			pre = "C-"
-			k = string('a' - 1 + int(e.Key))
+			k = string(rune('a' - 1 + int(e.Key)))
 			kmap := map[termbox.Key][2]string{
 				termbox.KeyCtrlSpace:     {"C-", "<space>"},
 				termbox.KeyBackspace:     {"", "<backspace>"},
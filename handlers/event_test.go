@@ -0,0 +1,181 @@
+//go:build linux
+// +build linux
+
+package handlers
+
+import (
+	"testing"
+
+	"github.com/nsf/termbox-go"
+
+	"github.com/jvalduvieco/slack-term/config"
+	"github.com/jvalduvieco/slack-term/context"
+	"github.com/jvalduvieco/slack-term/service"
+	"github.com/jvalduvieco/slack-term/views"
+)
+
+// createTestContext returns a context with the views of a FakeService
+// with the channels #general, which is selected, and #random
+func createTestContext(t *testing.T) (*context.AppContext, *service.FakeService) {
+	fake, err := service.CreateFakeService(&service.Fixtures{
+		Teams: []service.FixtureTeam{
+			{
+				ClientID:      "T1",
+				CurrentUserID: "U1",
+				Users:         map[string]string{"U1": "me", "U2": "bob"},
+				Channels: []service.FixtureChannel{
+					{
+						ID: "C1", Name: "general", Type: "channel",
+						Messages: []service.FixtureMessage{{User: "U2", Text: "hello"}},
+					},
+					{
+						ID: "C2", Name: "random", Type: "channel",
+						Messages: []service.FixtureMessage{{User: "U2", Text: "welcome"}},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a config file NewConfig returns the defaults
+	cfg, _ := config.NewConfig("")
+
+	ctx := &context.AppContext{
+		Service: fake,
+		View:    views.CreateUIComponents(cfg, fake),
+		Config:  cfg,
+		Mode:    context.CommandMode,
+	}
+	handlePendingEvents(ctx)
+
+	if channelID := ctx.View.Channels.GetSelectedChannelID(); channelID != "C1" {
+		t.Fatalf("got selected channel %q, want \"C1\"", channelID)
+	}
+	return ctx, fake
+}
+
+// handlePendingEvents handles the events the service has sent, like
+// incomingMessageHandler does
+func handlePendingEvents(ctx *context.AppContext) {
+	for {
+		select {
+		case msg := <-ctx.Service.IncomingEvents():
+			handleIncomingEvent(ctx, msg)
+		default:
+			return
+		}
+	}
+}
+
+// lastMessage returns the newest message of the Chat pane
+func lastMessage(t *testing.T, ctx *context.AppContext) service.Message {
+	ctx.View.Chat.ClearSelection()
+	ctx.View.Chat.SelectPrevious()
+	defer ctx.View.Chat.ClearSelection()
+
+	message, ok := ctx.View.Chat.GetSelectedMessage()
+	if !ok {
+		t.Fatal("the Chat pane doesn't show any message")
+	}
+	return message
+}
+
+func TestSend(t *testing.T) {
+	ctx, fake := createTestContext(t)
+
+	actionInsertMode(ctx)
+	for _, key := range "hi" {
+		actionInput(ctx.View, key)
+	}
+	actionSpace(ctx)
+	actionInput(ctx.View, 'x')
+	actionSend(ctx)
+
+	if !ctx.View.Input.IsEmpty() {
+		t.Errorf("got input %q after sending, want it empty", ctx.View.Input.GetText())
+	}
+
+	messages := fake.GetMessages("C1", 10)
+	if last := messages[len(messages)-1]; last.Text != "hi x" {
+		t.Errorf("got last message %q in C1, want \"hi x\"", last.Text)
+	}
+
+	// The message is echoed back by the service
+	handlePendingEvents(ctx)
+	if message := lastMessage(t, ctx); message.Text != "hi x" {
+		t.Errorf("got newest message %q in the Chat pane, want \"hi x\"", message.Text)
+	}
+	if ctx.View.Channels.IsUnread("C1") {
+		t.Error("C1 is unread after sending a message to it")
+	}
+}
+
+func TestChangeChannel(t *testing.T) {
+	ctx, _ := createTestContext(t)
+
+	// 2g
+	ctx.Count = 2
+	actionMoveCursorTopChannels(ctx)
+
+	if channelID := ctx.View.Channels.GetSelectedChannelID(); channelID != "C2" {
+		t.Fatalf("got selected channel %q, want \"C2\"", channelID)
+	}
+	if message := lastMessage(t, ctx); message.Text != "welcome" {
+		t.Errorf("got newest message %q in the Chat pane, want \"welcome\"", message.Text)
+	}
+}
+
+func TestMarkAsRead(t *testing.T) {
+	ctx, fake := createTestContext(t)
+
+	fake.Emit("T1", "C2", "U2", "ping")
+	handlePendingEvents(ctx)
+
+	if !ctx.View.Channels.IsUnread("C2") {
+		t.Fatal("C2 isn't unread after a message arrived")
+	}
+	if message := lastMessage(t, ctx); message.Text != "hello" {
+		t.Errorf("got newest message %q in the Chat pane, want the message of C1", message.Text)
+	}
+
+	ctx.Count = 2
+	actionMoveCursorTopChannels(ctx)
+
+	if ctx.View.Channels.IsUnread("C2") {
+		t.Error("C2 is still unread after changing to it")
+	}
+	if message := lastMessage(t, ctx); message.Text != "ping" {
+		t.Errorf("got newest message %q in the Chat pane, want \"ping\"", message.Text)
+	}
+}
+
+func TestEscapeKey(t *testing.T) {
+	ctx, _ := createTestContext(t)
+	ctx.Mode = context.InsertMode
+
+	keys := &keySequence{}
+	escape := &escapeKey{}
+	bound := func(alt termbox.Event) bool {
+		return keys.binds(ctx, getKeyString(alt))
+	}
+	esc := termbox.Event{Type: termbox.EventKey, Key: termbox.KeyEsc}
+
+	// M-b is bound in insert mode
+	if events := escape.combine(esc, bound); len(events) != 0 {
+		t.Fatalf("got %d events for escape, want it to wait for the next key", len(events))
+	}
+	events := escape.combine(termbox.Event{Type: termbox.EventKey, Ch: 'b'}, bound)
+	if len(events) != 1 || getKeyString(events[0]) != "M-b" {
+		t.Fatalf("got %d events for escape b, want M-b", len(events))
+	}
+
+	// M-j isn't, so escape is handled before j
+	escape.combine(esc, bound)
+	events = escape.combine(termbox.Event{Type: termbox.EventKey, Ch: 'j'}, bound)
+	if len(events) != 2 || events[0].Key != termbox.KeyEsc || events[1].Ch != 'j' || events[1].Mod != 0 {
+		t.Fatalf("got %v for escape j, want escape followed by j", events)
+	}
+}
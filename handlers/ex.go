@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jvalduvieco/slack-term/context"
+	"github.com/jvalduvieco/slack-term/service"
+	"github.com/jvalduvieco/slack-term/views"
+)
+
+// maxExHistory is the number of command lines that are kept in the
+// history of ex mode
+const maxExHistory = 100
+
+// exHistory contains the command lines run in ex mode, from oldest to
+// newest
+var exHistory []string
+
+// The state of ex mode. The Input is borrowed for the command line, the
+// text and label it had are given back when ex mode is left.
+var (
+	exDraft        string
+	exDraftLabel   string
+	exLine         string // the line typed before browsing the history
+	exHistoryIndex int    // index in exHistory of the line shown
+	exCompletion   *completion
+)
+
+// completion is the state of completing a word of the command line,
+// pressing tab again shows the next candidate
+type completion struct {
+	base       string // the command line preceding the word
+	candidates []string
+	index      int
+	text       string // the command line with the shown candidate
+}
+
+// actionExMode switches to ex mode, where a command from commandMap can
+// be typed and run
+func actionExMode(ctx *context.AppContext) {
+	exDraft = ctx.View.Input.GetText()
+	exDraftLabel = ctx.View.Input.GetBorderLabel()
+	exHistoryIndex = len(exHistory)
+	exCompletion = nil
+
+	ctx.Mode = context.ExMode
+	ctx.View.Mode.SetText("EX")
+	ctx.View.Input.Clear()
+	ctx.View.Input.SetBorderLabel(":")
+	views.Render(ctx.View.Mode)
+	ctx.View.RenderInput()
+}
+
+// leaveExMode gives the Input back and switches to command mode
+func leaveExMode(ctx *context.AppContext) {
+	ctx.View.Input.SetText(exDraft)
+	ctx.View.Input.SetBorderLabel(exDraftLabel)
+	ctx.View.RenderInput()
+
+	actionCommandMode(ctx)
+}
+
+func actionExCancel(ctx *context.AppContext) {
+	leaveExMode(ctx)
+}
+
+// actionExBackspace removes the character in front of the cursor, like
+// in vim ex mode is left when the command line is empty
+func actionExBackspace(ctx *context.AppContext) {
+	if ctx.View.Input.IsEmpty() {
+		leaveExMode(ctx)
+		return
+	}
+	actionBackSpace(ctx)
+}
+
+// actionExRun leaves ex mode and runs the command on the command line,
+// the line is added to the history
+func actionExRun(ctx *context.AppContext) {
+	line := strings.TrimSpace(ctx.View.Input.GetText())
+	leaveExMode(ctx)
+	if line == "" {
+		return
+	}
+
+	if len(exHistory) == 0 || exHistory[len(exHistory)-1] != line {
+		exHistory = append(exHistory, line)
+	}
+	if len(exHistory) > maxExHistory {
+		exHistory = exHistory[len(exHistory)-maxExHistory:]
+	}
+
+	name, args := splitFirstWord(strings.TrimPrefix(line, ":"))
+	command, ok := commandMap[name]
+	if !ok {
+		showError(ctx, fmt.Errorf("unknown command %s", name))
+		return
+	}
+	command(ctx, args)
+}
+
+// actionExPrevious shows the previous command line of the history
+func actionExPrevious(ctx *context.AppContext) {
+	if exHistoryIndex == 0 {
+		return
+	}
+	if exHistoryIndex == len(exHistory) {
+		exLine = ctx.View.Input.GetText()
+	}
+
+	exHistoryIndex--
+	ctx.View.Input.SetText(exHistory[exHistoryIndex])
+	ctx.View.RenderInput()
+}
+
+// actionExNext shows the next command line of the history, after the
+// newest one the line that was being typed is shown
+func actionExNext(ctx *context.AppContext) {
+	if exHistoryIndex == len(exHistory) {
+		return
+	}
+
+	exHistoryIndex++
+	if exHistoryIndex == len(exHistory) {
+		ctx.View.Input.SetText(exLine)
+	} else {
+		ctx.View.Input.SetText(exHistory[exHistoryIndex])
+	}
+	ctx.View.RenderInput()
+}
+
+// actionExComplete completes the last word of the command line, which is
+// the name of the command or one of its arguments. When there are
+// several candidates they are shown in the label of the Input, and
+// completing again shows the next one.
+func actionExComplete(ctx *context.AppContext) {
+	text := ctx.View.Input.GetText()
+	if exCompletion != nil && exCompletion.text == text {
+		exCompletion.index = (exCompletion.index + 1) % len(exCompletion.candidates)
+	} else {
+		exCompletion = createCompletion(ctx, text)
+		if exCompletion == nil {
+			return
+		}
+	}
+
+	c := exCompletion
+	c.text = c.base + c.candidates[c.index]
+	ctx.View.Input.SetText(c.text)
+
+	label := ":"
+	if len(c.candidates) > 1 {
+		label = ": " + strings.Join(c.candidates, " ")
+	}
+	ctx.View.Input.SetBorderLabel(label)
+	ctx.View.RenderInput()
+}
+
+// createCompletion returns the completion of the last word of text, or
+// nil when nothing matches it
+func createCompletion(ctx *context.AppContext, text string) *completion {
+	i := strings.LastIndexAny(text, " \t")
+	base, word := text[:i+1], text[i+1:]
+
+	var candidates []string
+	if strings.TrimSpace(base) == "" {
+		for name := range commandMap {
+			candidates = append(candidates, name)
+		}
+		sort.Strings(candidates)
+	} else {
+		fields := strings.Fields(base)
+		complete, ok := completionMap[fields[0]]
+		if !ok {
+			return nil
+		}
+		candidates = complete(ctx, fields[1:], word)
+	}
+
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) {
+			matches = append(matches, candidate)
+		}
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+
+	return &completion{base: base, candidates: matches}
+}
+
+// completePath completes the path of :upload, directories end with a
+// slash
+func completePath(ctx *context.AppContext, args []string, word string) []string {
+	if len(args) > 0 {
+		return nil
+	}
+
+	// The paths keep the ~/ that was typed
+	pattern := expandHome(word)
+	paths, _ := filepath.Glob(pattern + "*")
+
+	var candidates []string
+	for _, path := range paths {
+		candidate := word + strings.TrimPrefix(path, pattern)
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			candidate += "/"
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates
+}
+
+// completeCreate completes the option of :create
+func completeCreate(ctx *context.AppContext, args []string, word string) []string {
+	if len(args) != 1 {
+		return nil
+	}
+	return []string{"private"}
+}
+
+// completeUser completes the user of :dm
+func completeUser(ctx *context.AppContext, args []string, word string) []string {
+	if len(args) > 0 {
+		return nil
+	}
+	return completeUsers(ctx, args, word)
+}
+
+// completeUsers completes the users of :mpdm, users that have been given
+// already are left out
+func completeUsers(ctx *context.AppContext, args []string, word string) []string {
+	clientID := ctx.View.Channels.GetSelectedClientID()
+	currentUser := ctx.Service.GetUserName(clientID, ctx.Service.GetCurrentUserID(clientID))
+
+	var candidates []string
+	for _, name := range ctx.Service.GetUserNames(clientID) {
+		if name != currentUser && !containsString(args, "@"+name) {
+			candidates = append(candidates, "@"+name)
+		}
+	}
+	return candidates
+}
+
+// completeUnjoined completes the channel of :join with the channels of
+// the team that haven't been joined
+func completeUnjoined(ctx *context.AppContext, args []string, word string) []string {
+	if len(args) > 0 {
+		return nil
+	}
+
+	clientID := ctx.View.Channels.GetSelectedClientID()
+	var channels service.Channels
+	for _, channel := range ctx.Service.GetUnjoinedChannels() {
+		if channel.ClientID == clientID {
+			channels = append(channels, channel)
+		}
+	}
+	return channelNames(channels)
+}
+
+// completeJoined completes the channel of :part with the channels and
+// groups of the team that have been joined
+func completeJoined(ctx *context.AppContext, args []string, word string) []string {
+	if len(args) > 0 {
+		return nil
+	}
+
+	clientID := ctx.View.Channels.GetSelectedClientID()
+	var channels service.Channels
+	for _, channel := range ctx.View.Channels.GetChannels() {
+		if channel.ClientID == clientID && channel.ChannelType != service.IM {
+			channels = append(channels, channel)
+		}
+	}
+	return channelNames(channels)
+}
+
+// channelNames returns the names of channels prefixed with #, in
+// alphabetical order
+func channelNames(channels service.Channels) []string {
+	var names []string
+	for _, channel := range channels {
+		names = append(names, "#"+channel.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// completeSetting completes the setting of :set
+func completeSetting(ctx *context.AppContext, args []string, word string) []string {
+	if len(args) > 0 {
+		return nil
+	}
+
+	var candidates []string
+	for name := range settingMap {
+		candidates = append(candidates, name+"=")
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+// completeMapKey completes the mode and the action of :map, the key is
+// typed as is
+func completeMapKey(ctx *context.AppContext, args []string, word string) []string {
+	var candidates []string
+	switch len(args) {
+	case 0:
+		for mode := range ctx.Config.KeyMap {
+			candidates = append(candidates, mode)
+		}
+	case 2:
+		for action := range actionMap {
+			candidates = append(candidates, action)
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+// containsString returns true when list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// copyToClipboard copies text to the system clipboard by piping it into
+// the clipboard tool of the platform
+func copyToClipboard(text string) error {
+	var candidates [][]string
+	switch runtime.GOOS {
+	case "darwin":
+		candidates = [][]string{{"pbcopy"}}
+	case "windows":
+		candidates = [][]string{{"clip"}}
+	default:
+		if os.Getenv("WAYLAND_DISPLAY") != "" {
+			candidates = append(candidates, []string{"wl-copy"})
+		}
+		candidates = append(candidates,
+			[]string{"xclip", "-selection", "clipboard"},
+			[]string{"xsel", "--clipboard", "--input"},
+		)
+	}
+
+	for _, candidate := range candidates {
+		if _, err := exec.LookPath(candidate[0]); err != nil {
+			continue
+		}
+
+		cmd := exec.Command(candidate[0], candidate[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		return cmd.Run()
+	}
+
+	return errors.New("couldn't find a clipboard tool")
+}
+
+// openURL opens url with the default application of the platform
+func openURL(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// Don't wait for the browser to exit, only reap it once it has
+	go cmd.Wait()
+	return nil
+}
+
+// editText opens text in the editor of the user, $VISUAL or $EDITOR, and
+// returns the text that has been saved. The editor is run by suspend,
+// which gives it the terminal.
+func editText(suspend func(func() error) error, text string) (string, error) {
+	file, err := ioutil.TempFile("", "slack-term-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString(text)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+
+	// The editor can come with arguments, like "code --wait"
+	var cmd *exec.Cmd
+	switch {
+	case runtime.GOOS == "windows" && editor == "":
+		cmd = exec.Command("notepad", file.Name())
+	case runtime.GOOS == "windows":
+		cmd = exec.Command("cmd", "/C", editor+" "+file.Name())
+	case editor == "":
+		cmd = exec.Command("vi", file.Name())
+	default:
+		cmd = exec.Command("sh", "-c", editor+` "$1"`, "sh", file.Name())
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := suspend(cmd.Run); err != nil {
+		return "", err
+	}
+
+	content, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
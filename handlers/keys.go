@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nsf/termbox-go"
+
+	"github.com/jvalduvieco/slack-term/context"
+	"github.com/jvalduvieco/slack-term/views"
+)
+
+// keyTrie is a node in the trie of the key sequences of a mode, the
+// children are keyed by the key strings of getKeyString. A node with an
+// action and children is a key sequence that is the start of a longer
+// one, like g when gg is mapped as well.
+type keyTrie struct {
+	action   string
+	children map[string]*keyTrie
+}
+
+// keyTries caches the trie of every mode, it is emptied when the key map
+// changes
+var keyTries = make(map[string]*keyTrie)
+
+// getKeyTrie returns the trie of the key sequences of mode
+func getKeyTrie(ctx *context.AppContext, mode string) *keyTrie {
+	if trie, ok := keyTries[mode]; ok {
+		return trie
+	}
+
+	leader := parseKeySequence(ctx.Config.Leader, nil)
+
+	trie := &keyTrie{children: make(map[string]*keyTrie)}
+	for sequence, action := range ctx.Config.KeyMap[mode] {
+		node := trie
+		for _, key := range parseKeySequence(sequence, leader) {
+			child, ok := node.children[key]
+			if !ok {
+				child = &keyTrie{children: make(map[string]*keyTrie)}
+				node.children[key] = child
+			}
+			node = child
+		}
+		node.action = action
+	}
+
+	keyTries[mode] = trie
+	return trie
+}
+
+// resetKeyTries makes the tries be built again from the key map
+func resetKeyTries() {
+	keyTries = make(map[string]*keyTrie)
+}
+
+// parseKeySequence splits a key sequence of the key map, like gg, C-wj or
+// <leader>q, into the key strings of getKeyString. <leader> is replaced by
+// the keys of leader.
+func parseKeySequence(sequence string, leader []string) []string {
+	var keys []string
+	for sequence != "" {
+		n := keyLength(sequence)
+		if sequence[:n] == "<leader>" {
+			keys = append(keys, leader...)
+		} else {
+			keys = append(keys, sequence[:n])
+		}
+		sequence = sequence[n:]
+	}
+	return keys
+}
+
+// keyLength returns the length of the first key of a key sequence, which
+// is a character, a name like <enter>, or one of those with modifiers
+// like C-k or M-<left>
+func keyLength(sequence string) int {
+	for _, modifier := range []string{"C-", "M-"} {
+		if strings.HasPrefix(sequence, modifier) && len(sequence) > len(modifier) {
+			return len(modifier) + keyLength(sequence[len(modifier):])
+		}
+	}
+
+	if strings.HasPrefix(sequence, "<") {
+		if i := strings.Index(sequence, ">"); i > 1 {
+			return i + 1
+		}
+	}
+
+	_, size := utf8.DecodeRuneInString(sequence)
+	return size
+}
+
+// keySequence keeps the keys that have been pressed so far, while they
+// are the start of one or more key sequences of the mode. A count can
+// be typed before the keys in command and select mode, e.g. 5j. The
+// pending count and keys are shown in the Mode component.
+type keySequence struct {
+	count int
+	keys  []string
+	chars []rune   // the characters of keys, 0 for special keys
+	node  *keyTrie // the node of keys, nil when no keys are pending
+	timer *time.Timer
+	shown bool // whether the count or keys are shown
+}
+
+// timeout returns the channel that receives when the pending keys have
+// timed out, see Config.KeyTimeout
+func (k *keySequence) timeout() <-chan time.Time {
+	if k.timer == nil {
+		return nil
+	}
+	return k.timer.C
+}
+
+// press handles a key of the key string key and character ch. The action
+// of a complete key sequence is run right away, unless it is the start
+// of a longer one. Keys that don't start a key sequence are typed as
+// text in the modes that take text.
+func (k *keySequence) press(ctx *context.AppContext, key string, ch rune) {
+	node := k.node
+	if node == nil {
+		node = getKeyTrie(ctx, ctx.Mode)
+	}
+
+	next, ok := node.children[key]
+	switch {
+	case ok && len(next.children) == 0:
+		k.run(ctx, next.action)
+	case ok:
+		k.node = next
+		k.keys = append(k.keys, key)
+		k.chars = append(k.chars, ch)
+
+		if k.timer != nil {
+			k.timer.Stop()
+			k.timer = nil
+		}
+		if ctx.Config.KeyTimeout > 0 {
+			k.timer = time.NewTimer(time.Duration(ctx.Config.KeyTimeout) * time.Millisecond)
+		}
+		k.show(ctx)
+	case k.node != nil:
+		// The pending keys don't continue with key, they are handled
+		// like they timed out before key is pressed again
+		k.expire(ctx)
+		k.press(ctx, key, ch)
+	case acceptsCount(ctx.Mode) && ch >= '0' && ch <= '9' && (ch != '0' || k.count > 0):
+		k.count = k.count*10 + int(ch-'0')
+		k.show(ctx)
+	default:
+		k.reset(ctx)
+		if ch != 0 {
+			actionText(ctx, ch)
+		}
+	}
+}
+
+// binds returns true when key continues the pending keys, or starts a key
+// sequence of the mode
+func (k *keySequence) binds(ctx *context.AppContext, key string) bool {
+	if k.node != nil {
+		if _, ok := k.node.children[key]; ok {
+			return true
+		}
+	}
+	_, ok := getKeyTrie(ctx, ctx.Mode).children[key]
+	return ok
+}
+
+// expire runs the action of the pending keys, when they form a complete
+// key sequence, or types them as text otherwise. The latter makes jk
+// mapped in insert mode type a lone j.
+func (k *keySequence) expire(ctx *context.AppContext) {
+	if k.node == nil {
+		return
+	}
+	if k.node.action != "" {
+		k.run(ctx, k.node.action)
+		return
+	}
+
+	chars := k.chars
+	k.reset(ctx)
+	for _, ch := range chars {
+		if ch != 0 {
+			actionText(ctx, ch)
+		}
+	}
+}
+
+// run runs the action with the name actionStr, the count is passed in
+// AppContext.Count
+func (k *keySequence) run(ctx *context.AppContext, actionStr string) {
+	count := k.count
+	k.reset(ctx)
+
+	action, ok := actionMap[actionStr]
+	if !ok {
+		return
+	}
+
+	ctx.Count = count
+	action(ctx)
+	ctx.Count = 0
+}
+
+// reset forgets the pending count and keys
+func (k *keySequence) reset(ctx *context.AppContext) {
+	if k.timer != nil {
+		k.timer.Stop()
+	}
+	if k.shown {
+		ctx.View.Mode.SetStatus("")
+		views.Render(ctx.View.Mode)
+	}
+	*k = keySequence{}
+}
+
+// show shows the pending count and keys in the Mode component
+func (k *keySequence) show(ctx *context.AppContext) {
+	status := strings.Join(k.keys, "")
+	if k.count > 0 {
+		status = fmt.Sprintf("%d%s", k.count, status)
+	}
+
+	k.shown = true
+	modeReset.cancel()
+	ctx.View.Mode.SetStatus(status)
+	views.Render(ctx.View.Mode)
+}
+
+// acceptsCount returns true when a count can be typed in mode, in the
+// other modes digits are typed as text
+func acceptsCount(mode string) bool {
+	return mode == context.CommandMode || mode == context.SelectMode
+}
+
+// repeatCount returns the number of times an action that can be repeated
+// should be run, which is the count typed before it or 1
+func repeatCount(ctx *context.AppContext) int {
+	if ctx.Count > 0 {
+		return ctx.Count
+	}
+	return 1
+}
+
+// escapeDelay is the time an escape key waits for the key that follows it,
+// see escapeKey
+const escapeDelay = 50 * time.Millisecond
+
+// escapeKey combines an escape key with the key that follows it right
+// away into an alt key, like M-b. Terminals send alt keys as escape
+// followed by the key, which termbox reports as two key events. Keys
+// typed quickly after escape, like a fast Esc j to leave insert mode and
+// move down, stay apart when the alt key isn't bound.
+type escapeKey struct {
+	timer *time.Timer
+}
+
+// timeout returns the channel that receives when an escape key hasn't
+// been followed by another key, see expire
+func (e *escapeKey) timeout() <-chan time.Time {
+	if e.timer == nil {
+		return nil
+	}
+	return e.timer.C
+}
+
+// combine returns the key events to handle for ev, none when ev is an
+// escape key that waits for the next key. bound tells whether an alt key
+// is bound in the current mode.
+func (e *escapeKey) combine(ev termbox.Event, bound func(termbox.Event) bool) []termbox.Event {
+	var events []termbox.Event
+	if e.timer != nil {
+		e.timer.Stop()
+		e.timer = nil
+
+		alt := ev
+		alt.Mod |= termbox.ModAlt
+		if bound(alt) {
+			return []termbox.Event{alt}
+		}
+		events = append(events, e.expire())
+	}
+
+	if ev.Key == termbox.KeyEsc && ev.Ch == 0 && ev.Mod == 0 {
+		e.timer = time.NewTimer(escapeDelay)
+		return events
+	}
+	return append(events, ev)
+}
+
+// expire returns the escape key that hasn't been followed by another key
+func (e *escapeKey) expire() termbox.Event {
+	e.timer = nil
+	return termbox.Event{Type: termbox.EventKey, Key: termbox.KeyEsc}
+}
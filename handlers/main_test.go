@@ -0,0 +1,99 @@
+//go:build linux
+// +build linux
+
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"github.com/gizak/termui"
+)
+
+// ttyEnv is set when the tests run in the pseudo terminal of TestMain
+const ttyEnv = "SLACK_TERM_TEST_TTY"
+
+// The handlers render with termui, which needs a terminal to draw on.
+// TestMain runs the tests again in a pseudo terminal, so they don't
+// depend on the terminal go test is started from.
+func TestMain(m *testing.M) {
+	if os.Getenv(ttyEnv) == "" {
+		code, err := runInTerminal()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "not able to run the tests in a terminal: %s\n", err)
+		}
+		os.Exit(code)
+	}
+
+	if err := termui.Init(); err != nil {
+		fmt.Fprintf(os.Stderr, "not able to start termui: %s\n", err)
+		os.Exit(1)
+	}
+	code := m.Run()
+	termui.Close()
+	os.Exit(code)
+}
+
+// runInTerminal runs the test binary with a pseudo terminal of 120x40 as
+// controlling terminal, and returns its exit code
+func runInTerminal() (int, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		return 1, err
+	}
+	defer master.Close()
+
+	var unlock int32
+	if err := ioctl(master.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		return 1, err
+	}
+	var number uint32
+	if err := ioctl(master.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&number))); err != nil {
+		return 1, err
+	}
+
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", number), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return 1, err
+	}
+	defer slave.Close()
+
+	size := struct{ rows, cols, x, y uint16 }{40, 120, 0, 0}
+	if err := ioctl(slave.Fd(), syscall.TIOCSWINSZ, uintptr(unsafe.Pointer(&size))); err != nil {
+		return 1, err
+	}
+
+	cmd := exec.Command(os.Args[0], os.Args[1:]...)
+	cmd.Env = append(os.Environ(), ttyEnv+"=1")
+	cmd.Stdin = slave
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+	if err := cmd.Start(); err != nil {
+		return 1, err
+	}
+
+	// Whatever termui draws is thrown away
+	go io.Copy(ioutil.Discard, master)
+
+	if err := cmd.Wait(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ExitCode(), nil
+		}
+		return 1, err
+	}
+	return 0, nil
+}
+
+func ioctl(fd uintptr, request uintptr, arg uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, arg); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -4,11 +4,15 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
 	"os/user"
 	"path"
+	"strings"
 
 	"github.com/jvalduvieco/slack-term/context"
 	"github.com/jvalduvieco/slack-term/handlers"
+	"github.com/jvalduvieco/slack-term/service"
 	termbox "github.com/nsf/termbox-go"
 
 	"github.com/gizak/termui"
@@ -21,17 +25,26 @@ const (
 
 USAGE:
     slack-term -config [path-to-config]
+    slack-term -backend fake -fixtures [path-to-fixtures]
+    slack-term [global options] upload -channel [channel] < [file]
 
 VERSION:
     %s
 
 GLOBAL OPTIONS:
    --help, -h
+
+UPLOAD OPTIONS:
+   -channel    name or ID of the channel to upload to
+   -filename   name of the uploaded file (default "stdin")
+   -comment    message shared along with the file
 `
 )
 
 var (
-	flgConfig string
+	flgConfig   string
+	flgBackend  string
+	flgFixtures string
 )
 
 func init() {
@@ -49,6 +62,20 @@ func init() {
 		"location of config file",
 	)
 
+	flag.StringVar(
+		&flgBackend,
+		"backend",
+		context.SlackBackend,
+		"backend to use: slack or fake",
+	)
+
+	flag.StringVar(
+		&flgFixtures,
+		"fixtures",
+		"",
+		"location of the fixture file used by the fake backend",
+	)
+
 	flag.Usage = func() {
 		fmt.Printf(usage, version)
 	}
@@ -60,6 +87,11 @@ func main() {
 
 	var err error
 
+	if flag.Arg(0) == "upload" {
+		upload(flag.Args()[1:])
+		return
+	}
+
 	// Start terminal user interface
 	err = termui.Init()
 	if err != nil {
@@ -68,7 +100,10 @@ func main() {
 	defer termui.Close()
 
 	// Create context
-	ctx := context.CreateAppContext(flgConfig)
+	ctx := context.CreateAppContext(flgConfig, flgBackend, flgFixtures)
+	ctx.Suspend = func(run func() error) error {
+		return suspend(ctx, run)
+	}
 
 	// Register handlers
 	handlers.RegisterEventHandlers(ctx)
@@ -80,4 +115,86 @@ func main() {
 	}()
 
 	termui.Loop()
+
+	if errTerminal != nil {
+		log.Fatalf("ERROR: not able to take over the terminal again: %s", errTerminal)
+	}
+}
+
+// errTerminal is set when suspend couldn't take over the terminal again,
+// main exits with it once the event loop has stopped
+var errTerminal error
+
+// suspend gives the terminal back while run runs, e.g. to open an editor,
+// and lays out all widgets again afterwards. It is called by a handler, so
+// the other handlers wait until then, see AppContext.Lock.
+//
+// The terminal is released and taken over like termui.Close and
+// termui.Init do in main, only termbox is started again because
+// termui.Init would replace the Body. When that fails the event loop is
+// stopped, so main can exit.
+func suspend(ctx *context.AppContext, run func() error) error {
+	termui.Close()
+
+	// Interrupts typed in the terminal are sent to slack-term as well,
+	// they are meant for run
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	err := run()
+	signal.Stop(signals)
+
+	if initErr := termbox.Init(); initErr != nil {
+		// Nothing can be drawn anymore, see views.Render
+		errTerminal = initErr
+		termui.StopLoop()
+		return initErr
+	}
+
+	ctx.View.Resize()
+	return err
+}
+
+// upload uploads stdin to a channel without starting the terminal user
+// interface, e.g. to share a log file:
+//
+//	$ tail -n 100 app.log | slack-term upload -channel general
+func upload(args []string) {
+	var flgChannel, flgFilename, flgComment string
+
+	flags := flag.NewFlagSet("upload", flag.ExitOnError)
+	flags.StringVar(&flgChannel, "channel", "", "name or ID of the channel to upload to")
+	flags.StringVar(&flgFilename, "filename", "stdin", "name of the uploaded file")
+	flags.StringVar(&flgComment, "comment", "", "message shared along with the file")
+	flags.Usage = flag.Usage
+	flags.Parse(args)
+
+	if flgChannel == "" {
+		log.Fatal("ERROR: please specify a channel with -channel")
+	}
+
+	svc, err := context.CreateBackend(flgConfig, flgBackend, flgFixtures)
+	if err != nil {
+		log.Fatalf("ERROR: not able to create %s backend: %s", flgBackend, err)
+	}
+
+	channelID := findChannel(svc, flgChannel)
+	if channelID == "" {
+		log.Fatalf("ERROR: not a member of channel %s", flgChannel)
+	}
+
+	if err := svc.UploadFile(channelID, flgFilename, os.Stdin, flgComment); err != nil {
+		log.Fatalf("ERROR: not able to upload: %s", err)
+	}
+}
+
+// findChannel returns the ID of the joined channel with the given name or
+// ID, names may be prefixed with # or @
+func findChannel(svc service.Backend, channel string) string {
+	name := strings.TrimLeft(channel, "#@")
+	for _, chn := range svc.GetChannelList() {
+		if chn.ID == channel || chn.Name == name {
+			return chn.ID
+		}
+	}
+	return ""
 }
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+
+	slack "github.com/nlopes/slack"
+)
+
+// apiResponse is the part of the response that all Slack Web API methods
+// have in common
+type apiResponse struct {
+	Ok    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+// apiCall calls a Slack Web API method that isn't supported by
+// nlopes/slack and decodes the response into result. The token of the
+// client is added to values.
+func (s *SlackService) apiCall(clientID string, method string, values url.Values, result interface{}) error {
+	values.Set("token", s.tokens[clientID])
+
+	resp, err := http.PostForm(slack.SLACK_API+method, values)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return decodeResponse(method, resp, result)
+}
+
+// apiUpload calls a Slack Web API method like apiCall, but sends values as
+// multipart form with the contents of r as file named filename. The file
+// is streamed, so it is never read into memory as a whole.
+func (s *SlackService) apiUpload(clientID string, method string, values url.Values, filename string, r io.Reader, result interface{}) error {
+	values.Set("token", s.tokens[clientID])
+
+	body, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+
+	go func() {
+		for key := range values {
+			if err := form.WriteField(key, values.Get(key)); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+
+		part, err := form.CreateFormFile("file", filename)
+		if err == nil {
+			_, err = io.Copy(part, r)
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	resp, err := http.Post(slack.SLACK_API+method, form.FormDataContentType(), body)
+	if err != nil {
+		// Stops the writer when the request failed before reading all
+		body.CloseWithError(err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	return decodeResponse(method, resp, result)
+}
+
+// slackFileHost is the host of the private URLs of the files shared on
+// slack
+const slackFileHost = "files.slack.com"
+
+// apiDownload downloads a file from one of the private URLs of slack, like
+// url_private, into w. The token of the client authorizes the download, it
+// is only sent to the file host of slack and to the host of the API, see
+// isSlackURL.
+func (s *SlackService) apiDownload(clientID string, fileURL string, w io.Writer) error {
+	req, err := http.NewRequest("GET", fileURL, nil)
+	if err != nil {
+		return err
+	}
+	if isSlackURL(req.URL) {
+		req.Header.Set("Authorization", "Bearer "+s.tokens[clientID])
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download: unexpected status %s", resp.Status)
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// isSlackURL returns true when u is served by slack, on its file host over
+// https or on the host of the configured API
+func isSlackURL(u *url.URL) bool {
+	if u.Scheme == "https" && u.Host == slackFileHost {
+		return true
+	}
+
+	api, err := url.Parse(slack.SLACK_API)
+	return err == nil && u.Scheme == api.Scheme && u.Host == api.Host
+}
+
+// decodeResponse decodes the response of a Slack Web API method into
+// result, the response is an error when it isn't ok
+func decodeResponse(method string, resp *http.Response, result interface{}) error {
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %s", method, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var response apiResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return err
+	}
+	if !response.Ok {
+		return fmt.Errorf("%s: %s", method, response.Error)
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(body, result)
+}
@@ -0,0 +1,178 @@
+package service
+
+import "io"
+
+// Backend is the interface the rest of the application uses to talk to
+// a chat service. Handlers, views and the app context only ever depend
+// on this interface, SlackService is the implementation that is backed
+// by the Slack Web and RTM APIs.
+type Backend interface {
+	// GetClientIDs returns the identifiers of all configured teams
+	GetClientIDs() []string
+
+	// GetChannelList returns a list of all joined channels
+	GetChannelList() []Channel
+
+	// GetUnjoinedChannels returns a list of the channels of all teams
+	// that can be joined
+	GetUnjoinedChannels() []Channel
+
+	// JoinChannel will join a channel returned by GetUnjoinedChannels
+	// and returns it as joined channel
+	JoinChannel(channelID string) (Channel, error)
+
+	// LeaveChannel will leave a joined channel
+	LeaveChannel(channelID string) error
+
+	// CreateChannel will create a channel on the team identified by
+	// clientID, when private is set only invited members can join it.
+	// The channel is joined and returned.
+	CreateChannel(clientID string, name string, private bool) (Channel, error)
+
+	// OpenConversation will open a direct message channel with the
+	// users called userNames on the team identified by clientID, and
+	// returns it. An existing channel is returned when it is open
+	// already.
+	OpenConversation(clientID string, userNames []string) (Channel, error)
+
+	// SetChannelTopic will set the topic of a channel or group
+	SetChannelTopic(channelID string, topic string) error
+
+	// GetChannelName returns the channel name
+	GetChannelName(channelID string) string
+
+	// GetChannelTopic returns the channel topic
+	GetChannelTopic(channelID string) string
+
+	// GetMessages will get messages for a channel delimited by a count
+	GetMessages(channelID string, count int) []Message
+
+	// GetCachedMessages will get messages for a channel delimited by a
+	// count without going over the network
+	GetCachedMessages(channelID string, count int) []Message
+
+	// GetOlderMessages will get the count messages preceding the oldest
+	// message returned for a channel so far. No messages are returned
+	// when the beginning of the channel has been reached.
+	GetOlderMessages(channelID string, count int) ([]Message, error)
+
+	// GetThreadReplies will get the parent message of a thread followed
+	// by its replies
+	GetThreadReplies(channelID string, threadTimestamp string) ([]Message, error)
+
+	// SendMessage will send a message to a particular channel
+	SendMessage(channelID string, message string)
+
+	// SendReply will send a message as a reply in the thread of the
+	// message with threadTimestamp, when broadcast is set the reply is
+	// sent to the channel as well
+	SendReply(channelID string, threadTimestamp string, message string, broadcast bool)
+
+	// UpdateMessage will replace the text of the message with timestamp
+	UpdateMessage(channelID string, timestamp string, message string) error
+
+	// DeleteMessage will delete the message with timestamp
+	DeleteMessage(channelID string, timestamp string) error
+
+	// AddReaction will add the reaction name of the current user to the
+	// message with timestamp
+	AddReaction(channelID string, timestamp string, name string) error
+
+	// RemoveReaction will remove the reaction name of the current user
+	// from the message with timestamp
+	RemoveReaction(channelID string, timestamp string, name string) error
+
+	// UploadFile will upload the contents of r as a file named filename
+	// to a channel, comment is shared along with the file. The file
+	// comes back as incoming message.
+	UploadFile(channelID string, filename string, r io.Reader, comment string) error
+
+	// DownloadFile will write the contents of file, which is shared in
+	// a channel, to w
+	DownloadFile(channelID string, file File, w io.Writer) error
+
+	// SetChannelReadMark will set the read mark for a channel
+	SetChannelReadMark(channelID string)
+
+	// GetCurrentUserID returns the ID of the user that is logged in on
+	// the team identified by clientID
+	GetCurrentUserID(clientID string) string
+
+	// GetUserName returns the name of the user identified by userID
+	GetUserName(clientID string, userID string) string
+
+	// GetUserNames returns the names of the users of the team
+	// identified by clientID, in alphabetical order
+	GetUserNames(clientID string) []string
+
+	// GetCustomEmoji returns the custom emoji of the team identified by
+	// clientID, see resolveCustomEmoji. It doesn't wait for emoji that
+	// are still being fetched, a CustomEmojiEvent follows when they are.
+	GetCustomEmoji(clientID string) map[string]string
+
+	// IncomingEvents returns the stream of events coming in from all
+	// the teams
+	IncomingEvents() <-chan Event
+}
+
+// Event is an event received from a Backend. ClientID identifies the
+// team the event belongs to, Data holds one of the event types below.
+type Event struct {
+	ClientID string
+	Data     interface{}
+}
+
+// ConnectedEvent is sent when a connection to a team has been made
+type ConnectedEvent struct {
+	// UnreadChannelIDs contains the channels with unread messages
+	UnreadChannelIDs []string
+}
+
+// MessageEvent is sent when a new message arrives in a channel
+type MessageEvent struct {
+	ChannelID string
+	UserID    string
+	Message   Message
+}
+
+// MessageChangedEvent is sent when a message has been edited, or when
+// the reply count of a thread parent has changed
+type MessageChangedEvent struct {
+	ChannelID string
+	Message   Message
+}
+
+// MessageDeletedEvent is sent when a message has been deleted
+type MessageDeletedEvent struct {
+	ChannelID string
+	Timestamp string
+}
+
+// ReactionAddedEvent is sent when a user has added a reaction to a message
+type ReactionAddedEvent struct {
+	ChannelID string
+	Timestamp string
+	UserID    string
+	Name      string
+}
+
+// ReactionRemovedEvent is sent when a user has removed a reaction from a
+// message
+type ReactionRemovedEvent struct {
+	ChannelID string
+	Timestamp string
+	UserID    string
+	Name      string
+}
+
+// CustomEmojiEvent is sent when the custom emoji of a team have been
+// fetched, see Backend.GetCustomEmoji
+type CustomEmojiEvent struct {
+	Emoji map[string]string
+}
+
+// ErrorEvent is sent when something failed in the background, that isn't
+// the result of a call of the handlers, like writing the message cache
+type ErrorEvent struct {
+	Err error
+}
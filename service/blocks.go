@@ -0,0 +1,117 @@
+package service
+
+import (
+	"encoding/json"
+
+	slack "github.com/nlopes/slack"
+)
+
+// Block is a Block Kit layout block of a message, see
+// https://api.slack.com/reference/block-kit/blocks. Only the parts of a
+// block that can be shown in a terminal are kept.
+type Block struct {
+	Type string // section, context, divider, header or actions
+
+	// Text is the text of a section or a header
+	Text BlockText
+
+	// Fields are the fields of a section
+	Fields []BlockText
+
+	// Elements are the texts and image descriptions of a context, or
+	// the labels of the buttons and menus of actions
+	Elements []BlockText
+}
+
+// BlockText is a text of a Block
+type BlockText struct {
+	Text   string
+	Mrkdwn bool // whether Text is formatted in mrkdwn or is plain text
+}
+
+// slackMessage is a message as sent by slack. nlopes/slack doesn't know
+// about blocks nor about the list of files that replaced the single file
+// of a message, so they are decoded next to the message.
+type slackMessage struct {
+	slack.Message
+	Blocks []slackBlock `json:"blocks,omitempty"`
+	Files  []slack.File `json:"files,omitempty"`
+}
+
+// slackBlock is a block as sent by slack, see createBlocks
+type slackBlock struct {
+	Type     string              `json:"type"`
+	Text     *slackBlockText     `json:"text,omitempty"`
+	Fields   []slackBlockText    `json:"fields,omitempty"`
+	Elements []slackBlockElement `json:"elements,omitempty"`
+}
+
+// slackBlockText is a text object of a block
+type slackBlockText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// slackBlockElement is an element of a context or actions block. The text
+// of context elements is a string, the text of buttons is a text object.
+type slackBlockElement struct {
+	Type        string          `json:"type"`
+	Text        json.RawMessage `json:"text,omitempty"`
+	AltText     string          `json:"alt_text,omitempty"`
+	Placeholder *slackBlockText `json:"placeholder,omitempty"`
+}
+
+// createBlockText creates the BlockText of a text object
+func createBlockText(text slackBlockText) BlockText {
+	return BlockText{Text: text.Text, Mrkdwn: text.Type == "mrkdwn"}
+}
+
+// createBlocks creates the blocks of a message. Blocks that can't be
+// shown are left out, this includes the rich_text blocks slack adds to
+// the messages of users as those repeat the text of the message.
+func createBlocks(blocks []slackBlock) []Block {
+	var result []Block
+	for _, block := range blocks {
+		b := Block{Type: block.Type}
+
+		switch block.Type {
+		case "section", "header":
+			if block.Text != nil {
+				b.Text = createBlockText(*block.Text)
+			}
+			for _, field := range block.Fields {
+				b.Fields = append(b.Fields, createBlockText(field))
+			}
+		case "context":
+			for _, element := range block.Elements {
+				switch element.Type {
+				case "mrkdwn", "plain_text":
+					var text string
+					if err := json.Unmarshal(element.Text, &text); err == nil {
+						b.Elements = append(b.Elements, BlockText{Text: text, Mrkdwn: element.Type == "mrkdwn"})
+					}
+				case "image":
+					if element.AltText != "" {
+						b.Elements = append(b.Elements, BlockText{Text: element.AltText})
+					}
+				}
+			}
+		case "actions":
+			for _, element := range block.Elements {
+				var text slackBlockText
+				if element.Placeholder != nil {
+					text = *element.Placeholder
+				} else if err := json.Unmarshal(element.Text, &text); err != nil {
+					continue
+				}
+				b.Elements = append(b.Elements, createBlockText(text))
+			}
+		case "divider":
+		default:
+			continue
+		}
+
+		result = append(result, b)
+	}
+	return result
+}
@@ -0,0 +1,344 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxCachedMessages is the maximum number of messages kept per channel,
+// when exceeded the oldest messages are dropped
+const maxCachedMessages = 5000
+
+// MessageCache is a persistent on-disk store of the messages of channels,
+// keyed by ClientID and channel ID. Every channel is stored in its own
+// log file:
+//
+//	<dir>/<clientID>/<channelID>.jsonl
+//
+// A log file contains a JSON record per line, see cacheRecord. Added,
+// updated and deleted messages are appended as a record, so a change
+// doesn't rewrite the channel. The log is rewritten with only the cached
+// messages when it holds too many stale records, see compactionRatio.
+//
+// A nil *MessageCache is valid and caches nothing.
+type MessageCache struct {
+	mu       sync.Mutex
+	dir      string
+	channels map[string][]slackMessage
+	records  map[string]int // number of records in the log of a channel, -1 when it's broken
+}
+
+// cacheRecord is a line of the log of a channel, it either contains an
+// added or updated message or the timestamp of a deleted message
+type cacheRecord struct {
+	Message *slackMessage `json:"message,omitempty"`
+	Deleted string        `json:"deleted,omitempty"`
+}
+
+// compactionRatio is the number of records per cached message at which
+// the log of a channel is rewritten
+const compactionRatio = 2
+
+// OpenMessageCache opens the cache stored in dir, the directory is created
+// when it doesn't exist yet.
+func OpenMessageCache(dir string) (*MessageCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &MessageCache{
+		dir:      dir,
+		channels: make(map[string][]slackMessage),
+		records:  make(map[string]int),
+	}, nil
+}
+
+// Messages returns the cached messages of a channel, ordered from oldest
+// to newest
+func (c *MessageCache) Messages(clientID string, channelID string) []slackMessage {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	messages := c.load(clientID, channelID)
+	result := make([]slackMessage, len(messages))
+	copy(result, messages)
+	return result
+}
+
+// Latest returns the timestamp of the newest cached message of a channel,
+// or an empty string when nothing is cached
+func (c *MessageCache) Latest(clientID string, channelID string) string {
+	if c == nil {
+		return ""
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	messages := c.load(clientID, channelID)
+	if len(messages) == 0 {
+		return ""
+	}
+	return messages[len(messages)-1].Timestamp
+}
+
+// Add merges messages into the cache of a channel and persists them,
+// messages that are already cached are replaced.
+func (c *MessageCache) Add(clientID string, channelID string, messages ...slackMessage) error {
+	if c == nil || len(messages) == 0 {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	byTimestamp := make(map[string]slackMessage)
+	for _, message := range c.load(clientID, channelID) {
+		byTimestamp[message.Timestamp] = message
+	}
+
+	var records []cacheRecord
+	for i := range messages {
+		byTimestamp[messages[i].Timestamp] = messages[i]
+		records = append(records, cacheRecord{Message: &messages[i]})
+	}
+
+	merged := make([]slackMessage, 0, len(byTimestamp))
+	for _, message := range byTimestamp {
+		merged = append(merged, message)
+	}
+
+	return c.store(clientID, channelID, merged, records)
+}
+
+// Update replaces a cached message of a channel with message, it does
+// nothing when the message isn't cached.
+func (c *MessageCache) Update(clientID string, channelID string, message slackMessage) error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	messages := c.load(clientID, channelID)
+	for i := range messages {
+		if messages[i].Timestamp == message.Timestamp {
+			updated := make([]slackMessage, len(messages))
+			copy(updated, messages)
+			updated[i] = message
+			return c.store(clientID, channelID, updated, []cacheRecord{{Message: &message}})
+		}
+	}
+	return nil
+}
+
+// Delete removes a cached message of a channel, it does nothing when the
+// message isn't cached.
+func (c *MessageCache) Delete(clientID string, channelID string, timestamp string) error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	messages := c.load(clientID, channelID)
+	for i := range messages {
+		if messages[i].Timestamp == timestamp {
+			var remaining []slackMessage
+			remaining = append(remaining, messages[:i]...)
+			remaining = append(remaining, messages[i+1:]...)
+			return c.store(clientID, channelID, remaining, []cacheRecord{{Deleted: timestamp}})
+		}
+	}
+	return nil
+}
+
+// Replace replaces all cached messages of a channel and persists them
+func (c *MessageCache) Replace(clientID string, channelID string, messages []slackMessage) error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	replaced := make([]slackMessage, len(messages))
+	copy(replaced, messages)
+
+	c.setMessages(clientID, channelID, replaced)
+	return c.compact(clientID, channelID)
+}
+
+// load returns the messages of a channel, replaying its log from disk when
+// they aren't in memory yet. The caller must hold c.mu.
+func (c *MessageCache) load(clientID string, channelID string) []slackMessage {
+	key := path.Join(clientID, channelID)
+	if messages, ok := c.channels[key]; ok {
+		return messages
+	}
+
+	byTimestamp := make(map[string]slackMessage)
+	records := 0
+
+	file, err := os.Open(c.filename(clientID, channelID))
+	if err == nil {
+		decoder := json.NewDecoder(bufio.NewReader(file))
+		for {
+			var record cacheRecord
+			if err := decoder.Decode(&record); err != nil {
+				// A record that can't be read, like a line that was
+				// half written, ends the log. The log is rewritten with
+				// the next change, so new records don't follow it.
+				if err != io.EOF {
+					records = -1
+				}
+				break
+			}
+
+			if record.Message != nil {
+				byTimestamp[record.Message.Timestamp] = *record.Message
+			} else {
+				delete(byTimestamp, record.Deleted)
+			}
+			records++
+		}
+		file.Close()
+	}
+
+	var messages []slackMessage
+	for _, message := range byTimestamp {
+		messages = append(messages, message)
+	}
+	c.setMessages(clientID, channelID, messages)
+	c.records[key] = records
+
+	return c.channels[key]
+}
+
+// setMessages sorts and trims the messages of a channel and keeps them in
+// memory. The caller must hold c.mu.
+func (c *MessageCache) setMessages(clientID string, channelID string, messages []slackMessage) {
+	sort.Slice(messages, func(i, j int) bool {
+		return timestampLess(messages[i].Timestamp, messages[j].Timestamp)
+	})
+	if len(messages) > maxCachedMessages {
+		messages = messages[len(messages)-maxCachedMessages:]
+	}
+	c.channels[path.Join(clientID, channelID)] = messages
+}
+
+// store keeps the messages of a channel and appends records to its log,
+// the log is compacted when it has grown too much. The caller must hold
+// c.mu.
+func (c *MessageCache) store(clientID string, channelID string, messages []slackMessage, records []cacheRecord) error {
+	c.setMessages(clientID, channelID, messages)
+
+	key := path.Join(clientID, channelID)
+	if n := c.records[key]; n < 0 || n+len(records) > compactionRatio*(len(c.channels[key])+1) {
+		return c.compact(clientID, channelID)
+	}
+
+	var data []byte
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+
+	filename := c.filename(clientID, channelID)
+	if err := os.MkdirAll(path.Dir(filename), 0700); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+
+		// The log may end in a half written record now
+		c.records[key] = -1
+		return err
+	}
+	c.records[key] += len(records)
+	return file.Close()
+}
+
+// compact rewrites the log of a channel with a record for every cached
+// message. The caller must hold c.mu.
+func (c *MessageCache) compact(clientID string, channelID string) error {
+	key := path.Join(clientID, channelID)
+	messages := c.channels[key]
+
+	var data []byte
+	for i := range messages {
+		line, err := json.Marshal(cacheRecord{Message: &messages[i]})
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+
+	filename := c.filename(clientID, channelID)
+	if err := os.MkdirAll(path.Dir(filename), 0700); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so we never end up with a half
+	// written log
+	tmp := filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		return err
+	}
+	c.records[key] = len(messages)
+	return nil
+}
+
+func (c *MessageCache) filename(clientID string, channelID string) string {
+	return path.Join(c.dir, clientID, channelID+".jsonl")
+}
+
+// timestampLess reports whether the slack timestamp a is before b.
+// Timestamps are compared as seconds and fraction separately, because
+// parsing them as float64 loses precision in the microseconds.
+func timestampLess(a string, b string) bool {
+	secA, fracA := splitTimestamp(a)
+	secB, fracB := splitTimestamp(b)
+	if secA != secB {
+		return secA < secB
+	}
+	return fracA < fracB
+}
+
+func splitTimestamp(ts string) (int64, int64) {
+	parts := strings.SplitN(ts, ".", 2)
+	sec, _ := strconv.ParseInt(parts[0], 10, 64)
+
+	var frac int64
+	if len(parts) == 2 {
+		// pad to microseconds so "1.5" and "1.500000" compare equal
+		digits := (parts[1] + "000000")[:6]
+		frac, _ = strconv.ParseInt(digits, 10, 64)
+	}
+	return sec, frac
+}
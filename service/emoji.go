@@ -0,0 +1,411 @@
+package service
+
+import "strings"
+
+// emojiCodes maps the most common slack emoji shortcodes to their unicode
+// counterparts. Variation selectors are left out on purpose, terminals
+// can't combine them and they would break the width calculation.
+var emojiCodes = map[string]string{
+	// Smileys
+	"grinning":                      "\U0001F600",
+	"smiley":                        "\U0001F603",
+	"smile":                         "\U0001F604",
+	"grin":                          "\U0001F601",
+	"laughing":                      "\U0001F606",
+	"satisfied":                     "\U0001F606",
+	"sweat_smile":                   "\U0001F605",
+	"joy":                           "\U0001F602",
+	"rolling_on_the_floor_laughing": "\U0001F923",
+	"slightly_smiling_face":         "\U0001F642",
+	"upside_down_face":              "\U0001F643",
+	"wink":                          "\U0001F609",
+	"blush":                         "\U0001F60A",
+	"innocent":                      "\U0001F607",
+	"heart_eyes":                    "\U0001F60D",
+	"star-struck":                   "\U0001F929",
+	"kissing_heart":                 "\U0001F618",
+	"kissing":                       "\U0001F617",
+	"yum":                           "\U0001F60B",
+	"stuck_out_tongue":              "\U0001F61B",
+	"stuck_out_tongue_winking_eye":  "\U0001F61C",
+	"stuck_out_tongue_closed_eyes":  "\U0001F61D",
+	"money_mouth_face":              "\U0001F911",
+	"hugging_face":                  "\U0001F917",
+	"thinking_face":                 "\U0001F914",
+	"thinking":                      "\U0001F914",
+	"zipper_mouth_face":             "\U0001F910",
+	"neutral_face":                  "\U0001F610",
+	"expressionless":                "\U0001F611",
+	"no_mouth":                      "\U0001F636",
+	"smirk":                         "\U0001F60F",
+	"unamused":                      "\U0001F612",
+	"face_with_rolling_eyes":        "\U0001F644",
+	"grimacing":                     "\U0001F62C",
+	"lying_face":                    "\U0001F925",
+	"relieved":                      "\U0001F60C",
+	"pensive":                       "\U0001F614",
+	"sleepy":                        "\U0001F62A",
+	"sleeping":                      "\U0001F634",
+	"mask":                          "\U0001F637",
+	"face_with_thermometer":         "\U0001F912",
+	"nauseated_face":                "\U0001F922",
+	"sneezing_face":                 "\U0001F927",
+	"dizzy_face":                    "\U0001F635",
+	"exploding_head":                "\U0001F92F",
+	"sunglasses":                    "\U0001F60E",
+	"nerd_face":                     "\U0001F913",
+	"confused":                      "\U0001F615",
+	"worried":                       "\U0001F61F",
+	"slightly_frowning_face":        "\U0001F641",
+	"open_mouth":                    "\U0001F62E",
+	"hushed":                        "\U0001F62F",
+	"astonished":                    "\U0001F632",
+	"flushed":                       "\U0001F633",
+	"frowning":                      "\U0001F626",
+	"anguished":                     "\U0001F627",
+	"fearful":                       "\U0001F628",
+	"cold_sweat":                    "\U0001F630",
+	"disappointed_relieved":         "\U0001F625",
+	"cry":                           "\U0001F622",
+	"sob":                           "\U0001F62D",
+	"scream":                        "\U0001F631",
+	"confounded":                    "\U0001F616",
+	"persevere":                     "\U0001F623",
+	"disappointed":                  "\U0001F61E",
+	"sweat":                         "\U0001F613",
+	"weary":                         "\U0001F629",
+	"tired_face":                    "\U0001F62B",
+	"triumph":                       "\U0001F624",
+	"rage":                          "\U0001F621",
+	"angry":                         "\U0001F620",
+	"smiling_imp":                   "\U0001F608",
+	"skull":                         "\U0001F480",
+	"hankey":                        "\U0001F4A9",
+	"poop":                          "\U0001F4A9",
+	"clown_face":                    "\U0001F921",
+	"ghost":                         "\U0001F47B",
+	"alien":                         "\U0001F47D",
+	"robot_face":                    "\U0001F916",
+	"see_no_evil":                   "\U0001F648",
+	"hear_no_evil":                  "\U0001F649",
+	"speak_no_evil":                 "\U0001F64A",
+
+	// Hearts and symbols
+	"heart":                       "❤",
+	"orange_heart":                "\U0001F9E1",
+	"yellow_heart":                "\U0001F49B",
+	"green_heart":                 "\U0001F49A",
+	"blue_heart":                  "\U0001F499",
+	"purple_heart":                "\U0001F49C",
+	"black_heart":                 "\U0001F5A4",
+	"broken_heart":                "\U0001F494",
+	"sparkling_heart":             "\U0001F496",
+	"two_hearts":                  "\U0001F495",
+	"100":                         "\U0001F4AF",
+	"boom":                        "\U0001F4A5",
+	"collision":                   "\U0001F4A5",
+	"dizzy":                       "\U0001F4AB",
+	"zzz":                         "\U0001F4A4",
+	"sparkles":                    "✨",
+	"star":                        "⭐",
+	"star2":                       "\U0001F31F",
+	"zap":                         "⚡",
+	"fire":                        "\U0001F525",
+	"white_check_mark":            "✅",
+	"heavy_check_mark":            "✔",
+	"x":                           "❌",
+	"negative_squared_cross_mark": "❎",
+	"heavy_plus_sign":             "➕",
+	"heavy_minus_sign":            "➖",
+	"question":                    "❓",
+	"grey_question":               "❔",
+	"exclamation":                 "❗",
+	"heavy_exclamation_mark":      "❗",
+	"grey_exclamation":            "❕",
+	"warning":                     "⚠",
+	"no_entry":                    "⛔",
+	"no_entry_sign":               "\U0001F6AB",
+	"red_circle":                  "\U0001F534",
+	"large_blue_circle":           "\U0001F535",
+	"white_circle":                "⚪",
+	"black_circle":                "⚫",
+	"arrow_up":                    "⬆",
+	"arrow_down":                  "⬇",
+	"arrow_left":                  "⬅",
+	"arrow_right":                 "➡",
+	"repeat":                      "\U0001F501",
+	"arrows_counterclockwise":     "\U0001F504",
+	"link":                        "\U0001F517",
+	"lock":                        "\U0001F512",
+	"unlock":                      "\U0001F513",
+	"key":                         "\U0001F511",
+	"bell":                        "\U0001F514",
+	"mag":                         "\U0001F50D",
+	"bulb":                        "\U0001F4A1",
+	"memo":                        "\U0001F4DD",
+	"pencil":                      "\U0001F4DD",
+	"pencil2":                     "✏",
+	"calendar":                    "\U0001F4C6",
+	"date":                        "\U0001F4C5",
+	"pushpin":                     "\U0001F4CC",
+	"paperclip":                   "\U0001F4CE",
+	"email":                       "\U0001F4E7",
+	"envelope":                    "✉",
+	"inbox_tray":                  "\U0001F4E5",
+	"outbox_tray":                 "\U0001F4E4",
+	"package":                     "\U0001F4E6",
+	"chart_with_upwards_trend":    "\U0001F4C8",
+	"chart_with_downwards_trend":  "\U0001F4C9",
+	"bar_chart":                   "\U0001F4CA",
+	"clipboard":                   "\U0001F4CB",
+	"computer":                    "\U0001F4BB",
+	"iphone":                      "\U0001F4F1",
+	"phone":                       "☎",
+	"telephone":                   "☎",
+	"hourglass":                   "⌛",
+	"stopwatch":                   "⏱",
+	"alarm_clock":                 "⏰",
+	"moneybag":                    "\U0001F4B0",
+	"gem":                         "\U0001F48E",
+	"wrench":                      "\U0001F527",
+	"hammer":                      "\U0001F528",
+	"gear":                        "⚙",
+	"bomb":                        "\U0001F4A3",
+	"hourglass_flowing_sand":      "⏳",
+	"speech_balloon":              "\U0001F4AC",
+	"thought_balloon":             "\U0001F4AD",
+	"eyes":                        "\U0001F440",
+	"eye":                         "\U0001F441",
+	"brain":                       "\U0001F9E0",
+
+	// People and gestures
+	"wave":            "\U0001F44B",
+	"raised_hand":     "✋",
+	"hand":            "✋",
+	"ok_hand":         "\U0001F44C",
+	"+1":              "\U0001F44D",
+	"thumbsup":        "\U0001F44D",
+	"-1":              "\U0001F44E",
+	"thumbsdown":      "\U0001F44E",
+	"fist":            "✊",
+	"facepunch":       "\U0001F44A",
+	"punch":           "\U0001F44A",
+	"v":               "✌",
+	"crossed_fingers": "\U0001F91E",
+	"metal":           "\U0001F918",
+	"call_me_hand":    "\U0001F919",
+	"point_left":      "\U0001F448",
+	"point_right":     "\U0001F449",
+	"point_up":        "☝",
+	"point_up_2":      "\U0001F446",
+	"point_down":      "\U0001F447",
+	"middle_finger":   "\U0001F595",
+	"clap":            "\U0001F44F",
+	"raised_hands":    "\U0001F64C",
+	"open_hands":      "\U0001F450",
+	"pray":            "\U0001F64F",
+	"handshake":       "\U0001F91D",
+	"muscle":          "\U0001F4AA",
+	"writing_hand":    "✍",
+	"nail_care":       "\U0001F485",
+	"selfie":          "\U0001F933",
+	"man-shrugging":   "\U0001F937",
+	"shrug":           "\U0001F937",
+	"facepalm":        "\U0001F926",
+	"face_palm":       "\U0001F926",
+	"bow":             "\U0001F647",
+	"runner":          "\U0001F3C3",
+	"running":         "\U0001F3C3",
+	"dancer":          "\U0001F483",
+	"baby":            "\U0001F476",
+	"ninja":           "\U0001F977",
+
+	// Nature, food and activities
+	"dog":              "\U0001F436",
+	"cat":              "\U0001F431",
+	"mouse":            "\U0001F42D",
+	"rabbit":           "\U0001F430",
+	"fox_face":         "\U0001F98A",
+	"bear":             "\U0001F43B",
+	"panda_face":       "\U0001F43C",
+	"koala":            "\U0001F428",
+	"tiger":            "\U0001F42F",
+	"lion_face":        "\U0001F981",
+	"cow":              "\U0001F42E",
+	"pig":              "\U0001F437",
+	"frog":             "\U0001F438",
+	"monkey_face":      "\U0001F435",
+	"chicken":          "\U0001F414",
+	"penguin":          "\U0001F427",
+	"bird":             "\U0001F426",
+	"unicorn_face":     "\U0001F984",
+	"bee":              "\U0001F41D",
+	"honeybee":         "\U0001F41D",
+	"bug":              "\U0001F41B",
+	"snail":            "\U0001F40C",
+	"turtle":           "\U0001F422",
+	"snake":            "\U0001F40D",
+	"octopus":          "\U0001F419",
+	"whale":            "\U0001F433",
+	"dolphin":          "\U0001F42C",
+	"fish":             "\U0001F41F",
+	"shark":            "\U0001F988",
+	"crab":             "\U0001F980",
+	"rose":             "\U0001F339",
+	"sunflower":        "\U0001F33B",
+	"tulip":            "\U0001F337",
+	"seedling":         "\U0001F331",
+	"evergreen_tree":   "\U0001F332",
+	"palm_tree":        "\U0001F334",
+	"cactus":           "\U0001F335",
+	"four_leaf_clover": "\U0001F340",
+	"maple_leaf":       "\U0001F341",
+	"mushroom":         "\U0001F344",
+	"sunny":            "☀",
+	"cloud":            "☁",
+	"umbrella":         "☔",
+	"snowflake":        "❄",
+	"snowman":          "⛄",
+	"rainbow":          "\U0001F308",
+	"ocean":            "\U0001F30A",
+	"earth_africa":     "\U0001F30D",
+	"earth_americas":   "\U0001F30E",
+	"earth_asia":       "\U0001F30F",
+	"crescent_moon":    "\U0001F319",
+	"full_moon":        "\U0001F315",
+	"apple":            "\U0001F34E",
+	"green_apple":      "\U0001F34F",
+	"banana":           "\U0001F34C",
+	"lemon":            "\U0001F34B",
+	"cherries":         "\U0001F352",
+	"strawberry":       "\U0001F353",
+	"grapes":           "\U0001F347",
+	"watermelon":       "\U0001F349",
+	"peach":            "\U0001F351",
+	"pineapple":        "\U0001F34D",
+	"avocado":          "\U0001F951",
+	"eggplant":         "\U0001F346",
+	"tomato":           "\U0001F345",
+	"hot_pepper":       "\U0001F336",
+	"corn":             "\U0001F33D",
+	"bread":            "\U0001F35E",
+	"cheese_wedge":     "\U0001F9C0",
+	"egg":              "\U0001F95A",
+	"bacon":            "\U0001F953",
+	"hamburger":        "\U0001F354",
+	"fries":            "\U0001F35F",
+	"pizza":            "\U0001F355",
+	"hotdog":           "\U0001F32D",
+	"taco":             "\U0001F32E",
+	"burrito":          "\U0001F32F",
+	"ramen":            "\U0001F35C",
+	"spaghetti":        "\U0001F35D",
+	"sushi":            "\U0001F363",
+	"fried_shrimp":     "\U0001F364",
+	"rice":             "\U0001F35A",
+	"icecream":         "\U0001F366",
+	"doughnut":         "\U0001F369",
+	"cookie":           "\U0001F36A",
+	"birthday":         "\U0001F382",
+	"cake":             "\U0001F370",
+	"chocolate_bar":    "\U0001F36B",
+	"candy":            "\U0001F36C",
+	"popcorn":          "\U0001F37F",
+	"coffee":           "☕",
+	"tea":              "\U0001F375",
+	"beer":             "\U0001F37A",
+	"beers":            "\U0001F37B",
+	"wine_glass":       "\U0001F377",
+	"cocktail":         "\U0001F378",
+	"tropical_drink":   "\U0001F379",
+	"champagne":        "\U0001F37E",
+	"clinking_glasses": "\U0001F942",
+	"tada":             "\U0001F389",
+	"confetti_ball":    "\U0001F38A",
+	"balloon":          "\U0001F388",
+	"gift":             "\U0001F381",
+	"christmas_tree":   "\U0001F384",
+	"jack_o_lantern":   "\U0001F383",
+	"trophy":           "\U0001F3C6",
+	"medal":            "\U0001F3C5",
+	"sports_medal":     "\U0001F3C5",
+	"soccer":           "⚽",
+	"basketball":       "\U0001F3C0",
+	"football":         "\U0001F3C8",
+	"baseball":         "⚾",
+	"tennis":           "\U0001F3BE",
+	"dart":             "\U0001F3AF",
+	"video_game":       "\U0001F3AE",
+	"game_die":         "\U0001F3B2",
+	"musical_note":     "\U0001F3B5",
+	"notes":            "\U0001F3B6",
+	"headphones":       "\U0001F3A7",
+	"guitar":           "\U0001F3B8",
+	"art":              "\U0001F3A8",
+	"movie_camera":     "\U0001F3A5",
+	"camera":           "\U0001F4F7",
+	"books":            "\U0001F4DA",
+	"book":             "\U0001F4D6",
+	"newspaper":        "\U0001F4F0",
+
+	// Travel and places
+	"rocket":                  "\U0001F680",
+	"airplane":                "✈",
+	"car":                     "\U0001F697",
+	"red_car":                 "\U0001F697",
+	"taxi":                    "\U0001F695",
+	"bus":                     "\U0001F68C",
+	"train":                   "\U0001F686",
+	"bike":                    "\U0001F6B2",
+	"ship":                    "\U0001F6A2",
+	"rotating_light":          "\U0001F6A8",
+	"construction":            "\U0001F6A7",
+	"house":                   "\U0001F3E0",
+	"office":                  "\U0001F3E2",
+	"hospital":                "\U0001F3E5",
+	"school":                  "\U0001F3EB",
+	"tent":                    "⛺",
+	"checkered_flag":          "\U0001F3C1",
+	"triangular_flag_on_post": "\U0001F6A9",
+	"world_map":               "\U0001F5FA",
+	"globe_with_meridians":    "\U0001F310",
+}
+
+// LookupEmoji returns the unicode counterpart of an emoji shortcode, e.g.
+// "smile" or "thumbsup". Skin tone modifiers ("thumbsup::skin-tone-2")
+// are ignored.
+func LookupEmoji(name string) (string, bool) {
+	if i := strings.Index(name, "::skin-tone-"); i >= 0 {
+		name = name[:i]
+	}
+
+	code, ok := emojiCodes[name]
+	return code, ok
+}
+
+// resolveCustomEmoji turns the emoji list of a team, which maps the name
+// of a custom emoji to the URL of its image or to "alias:name" of another
+// emoji, into a map of name to unicode. Custom emoji that are images map
+// to an empty string as there is no unicode for them.
+func resolveCustomEmoji(list map[string]string) map[string]string {
+	emoji := make(map[string]string, len(list))
+	for name := range list {
+		target := name
+		// Aliases may point to other aliases, give up after a few
+		// hops to not get stuck on cycles
+		for i := 0; i < 5; i++ {
+			value := list[target]
+			if !strings.HasPrefix(value, "alias:") {
+				break
+			}
+			target = strings.TrimPrefix(value, "alias:")
+		}
+
+		if code, ok := LookupEmoji(target); ok {
+			emoji[name] = code
+		} else {
+			emoji[name] = ""
+		}
+	}
+	return emoji
+}
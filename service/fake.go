@@ -0,0 +1,1011 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fixtures is the content of a fixture file used by FakeService. A
+// fixture file resembles the following structure:
+//
+//	{
+//	    "teams": [
+//	        {
+//	            "client_id": "T1",
+//	            "current_user": "U1",
+//	            "users": {"U1": "me", "U2": "erroneousboat"},
+//	            "channels": [
+//	                {
+//	                    "id": "C1", "name": "general", "topic": "chit chat",
+//	                    "type": "channel", "unread": true,
+//	                    "messages": [{"user": "U2", "text": "Hello world!"}]
+//	                }
+//	            ],
+//	            "script": [
+//	                {"after": "2s", "channel": "C1", "user": "U2", "text": "ping"},
+//	                {"after": "1s", "channel": "C1", "user": "U1", "text": "pong",
+//	                 "thread_ts": "1500000000.000001"},
+//	                {"after": "1s", "type": "edit", "channel": "C1", "text": "pong"},
+//	                {"after": "1s", "type": "delete", "channel": "C1"}
+//	            ],
+//	            "loop": true
+//	        }
+//	    ]
+//	}
+//
+// The script is played once every team is loaded, every entry is sent
+// as an incoming message after waiting for its "after" duration. Messages
+// and entries with a "thread_ts" are replies in the thread of the message
+// with that timestamp, with "broadcast" they are sent to the channel as
+// well. Entries of type "edit" and "delete" change or remove the message
+// with timestamp "ts", or the last message of the channel when "ts" is
+// omitted. Entries of type "react" and "unreact" add or remove the
+// "reaction" of "user" to such a message. When "loop" is set the script
+// will be replayed forever.
+//
+// Channels with "unjoined" set aren't listed until they are joined,
+// "members" is the number of members a channel is shown with.
+type Fixtures struct {
+	Teams []FixtureTeam `json:"teams"`
+}
+
+// FixtureTeam describes a single team (ClientID) within Fixtures
+type FixtureTeam struct {
+	ClientID      string            `json:"client_id"`
+	CurrentUserID string            `json:"current_user"`
+	Users         map[string]string `json:"users"`
+	Emoji         map[string]string `json:"emoji"`
+	Channels      []FixtureChannel  `json:"channels"`
+	Script        []FixtureEvent    `json:"script"`
+	Loop          bool              `json:"loop"`
+}
+
+// FixtureChannel describes a channel, group or im channel and its history
+type FixtureChannel struct {
+	ID       string           `json:"id"`
+	Name     string           `json:"name"`
+	Topic    string           `json:"topic"`
+	Type     string           `json:"type"`
+	Unread   bool             `json:"unread"`
+	Unjoined bool             `json:"unjoined"`
+	Members  int              `json:"members"`
+	Messages []FixtureMessage `json:"messages"`
+}
+
+// FixtureMessage is a message in the history of a FixtureChannel, the
+// messages are ordered from oldest to newest. When Timestamp is empty a
+// timestamp will be generated.
+type FixtureMessage struct {
+	User            string `json:"user"`
+	Text            string `json:"text"`
+	Timestamp       string `json:"ts"`
+	ThreadTimestamp string `json:"thread_ts"`
+	Broadcast       bool   `json:"broadcast"`
+
+	// Reactions contains the users that reacted, keyed by reaction name
+	Reactions map[string][]string `json:"reactions"`
+
+	// Blocks are Block Kit blocks in the format slack sends them
+	Blocks json.RawMessage `json:"blocks"`
+
+	Files []FixtureFile `json:"files"`
+}
+
+// FixtureFile is a file shared in a FixtureMessage. When Size is omitted
+// it is the size of Content.
+type FixtureFile struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Title    string `json:"title"`
+	Mimetype string `json:"mimetype"`
+	Filetype string `json:"filetype"`
+	Size     int    `json:"size"`
+	Content  string `json:"content"`
+}
+
+// FixtureEvent is an entry of the script of a FixtureTeam, Type is one
+// of "message" (the default), "edit", "delete", "react" or "unreact"
+type FixtureEvent struct {
+	After     string `json:"after"`
+	Type      string `json:"type"`
+	Channel   string `json:"channel"`
+	User      string `json:"user"`
+	Text      string `json:"text"`
+	Timestamp string `json:"ts"`
+	Reaction  string `json:"reaction"`
+
+	ThreadTimestamp string `json:"thread_ts"`
+	Broadcast       bool   `json:"broadcast"`
+}
+
+// FakeService is an in-process implementation of Backend that serves
+// channels, users and history from fixtures. It doesn't need any tokens
+// nor a network connection, which makes it suitable for demos and
+// for exercising the handlers.
+type FakeService struct {
+	mu             sync.Mutex
+	teams          map[string]FixtureTeam
+	joinedChannels map[string]Channel
+	unjoined       map[string]Channel // channels that can be joined
+	history        map[string][]FixtureMessage
+	replies        map[string][]FixtureMessage // keyed by messageKey of the parent
+	reactions      map[string][]Reaction       // keyed by messageKey
+	unread         map[string][]string
+	oldest         map[string]int // index in history of the oldest message returned
+	events         chan Event
+	sequence       int
+	files          map[string]FixtureFile // shared files by ID
+}
+
+// LoadFixtures reads and parses a fixture file
+func LoadFixtures(filepath string) (*Fixtures, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var fixtures Fixtures
+	if err := json.NewDecoder(file).Decode(&fixtures); err != nil {
+		return nil, err
+	}
+
+	if len(fixtures.Teams) == 0 {
+		return nil, fmt.Errorf("couldn't find any team in fixture file %s", filepath)
+	}
+
+	return &fixtures, nil
+}
+
+// CreateFakeService is the constructor for the FakeService, it will
+// start playing the scripts of the fixtures.
+func CreateFakeService(fixtures *Fixtures) (*FakeService, error) {
+	svc := &FakeService{
+		teams:          make(map[string]FixtureTeam),
+		joinedChannels: make(map[string]Channel),
+		unjoined:       make(map[string]Channel),
+		history:        make(map[string][]FixtureMessage),
+		replies:        make(map[string][]FixtureMessage),
+		reactions:      make(map[string][]Reaction),
+		unread:         make(map[string][]string),
+		oldest:         make(map[string]int),
+		events:         make(chan Event, 50),
+		files:          make(map[string]FixtureFile),
+	}
+
+	for _, team := range fixtures.Teams {
+		if team.ClientID == "" {
+			return nil, fmt.Errorf("fixture team without 'client_id'")
+		}
+		svc.teams[team.ClientID] = team
+
+		for _, chn := range team.Channels {
+			channelType, err := parseChannelType(chn.Type)
+			if err != nil {
+				return nil, err
+			}
+
+			channel := Channel{chn.ID, chn.Name, chn.Topic, chn, team.ClientID, channelType, chn.Members}
+			if chn.Unjoined {
+				if channelType != CHANNEL {
+					return nil, fmt.Errorf("only channels can be unjoined, '%s' isn't one", chn.ID)
+				}
+				svc.unjoined[chn.ID] = channel
+			} else {
+				svc.joinedChannels[chn.ID] = channel
+			}
+
+			for _, msg := range chn.Messages {
+				if msg.Timestamp == "" {
+					msg.Timestamp = svc.nextTimestamp()
+				}
+				msg.Files = svc.loadFiles(msg)
+				svc.loadReactions(chn.ID, msg)
+				if msg.ThreadTimestamp != "" && msg.ThreadTimestamp != msg.Timestamp {
+					key := messageKey(chn.ID, msg.ThreadTimestamp)
+					svc.replies[key] = append(svc.replies[key], msg)
+					if !msg.Broadcast {
+						continue
+					}
+				}
+				svc.history[chn.ID] = append(svc.history[chn.ID], msg)
+			}
+
+			if chn.Unread && !chn.Unjoined {
+				svc.unread[team.ClientID] = append(svc.unread[team.ClientID], chn.ID)
+			}
+		}
+	}
+
+	for _, clientID := range svc.GetClientIDs() {
+		svc.events <- Event{
+			ClientID: clientID,
+			Data:     &ConnectedEvent{UnreadChannelIDs: svc.unread[clientID]},
+		}
+		go svc.playScript(svc.teams[clientID])
+	}
+
+	return svc, nil
+}
+
+// loadFiles keeps the files of a fixture message so they can be
+// downloaded, files without ID are given one
+func (f *FakeService) loadFiles(msg FixtureMessage) []FixtureFile {
+	var files []FixtureFile
+	for _, file := range msg.Files {
+		if file.ID == "" {
+			f.sequence++
+			file.ID = fmt.Sprintf("F%d", f.sequence)
+		}
+		f.files[file.ID] = file
+		files = append(files, file)
+	}
+	return files
+}
+
+// loadReactions adds the reactions of a fixture message
+func (f *FakeService) loadReactions(channelID string, msg FixtureMessage) {
+	var names []string
+	for name := range msg.Reactions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var message Message
+	for _, name := range names {
+		for _, user := range msg.Reactions[name] {
+			message.AddReaction(name, user)
+		}
+	}
+	f.reactions[messageKey(channelID, msg.Timestamp)] = message.Reactions
+}
+
+func parseChannelType(channelType string) (ChannelType, error) {
+	switch channelType {
+	case "", "channel":
+		return CHANNEL, nil
+	case "group":
+		return GROUP, nil
+	case "im":
+		return IM, nil
+	}
+	return 0, fmt.Errorf("unknown channel type '%s' in fixtures", channelType)
+}
+
+// playScript will send the script entries of a team as incoming messages
+func (f *FakeService) playScript(team FixtureTeam) {
+	if len(team.Script) == 0 {
+		return
+	}
+
+	for {
+		for _, entry := range team.Script {
+			after, err := time.ParseDuration(entry.After)
+			if err == nil {
+				time.Sleep(after)
+			}
+
+			switch entry.Type {
+			case "edit":
+				f.EmitEdit(team.ClientID, entry.Channel, entry.Timestamp, entry.Text)
+			case "delete":
+				f.EmitDelete(team.ClientID, entry.Channel, entry.Timestamp)
+			case "react":
+				f.EmitReaction(team.ClientID, entry.Channel, entry.Timestamp, entry.User, entry.Reaction, true)
+			case "unreact":
+				f.EmitReaction(team.ClientID, entry.Channel, entry.Timestamp, entry.User, entry.Reaction, false)
+			default:
+				if entry.ThreadTimestamp != "" {
+					f.EmitReply(team.ClientID, entry.Channel, entry.ThreadTimestamp, entry.User, entry.Text, entry.Broadcast)
+				} else {
+					f.Emit(team.ClientID, entry.Channel, entry.User, entry.Text)
+				}
+			}
+		}
+
+		if !team.Loop {
+			return
+		}
+	}
+}
+
+// Emit adds a message to the history of a channel and sends it as an
+// incoming message, as if it was sent by userID.
+func (f *FakeService) Emit(clientID string, channelID string, userID string, text string) {
+	f.mu.Lock()
+	msg := FixtureMessage{
+		User:      userID,
+		Text:      text,
+		Timestamp: f.nextTimestamp(),
+	}
+	f.mu.Unlock()
+
+	f.emit(clientID, channelID, msg)
+}
+
+// emit adds msg to the history of a channel and sends it as an incoming
+// message
+func (f *FakeService) emit(clientID string, channelID string, msg FixtureMessage) {
+	f.mu.Lock()
+	f.history[channelID] = append(f.history[channelID], msg)
+	message := f.createMessage(clientID, channelID, msg)
+	_, unjoined := f.unjoined[channelID]
+	f.mu.Unlock()
+
+	// Only members of a channel receive its messages
+	if unjoined {
+		return
+	}
+
+	f.events <- Event{
+		ClientID: clientID,
+		Data: &MessageEvent{
+			ChannelID: channelID,
+			UserID:    msg.User,
+			Message:   message,
+		},
+	}
+}
+
+// EmitReply adds a message to the replies of the thread of the message
+// with threadTimestamp and sends it as an incoming message, as if it was
+// sent by userID. When broadcast is set the reply is added to the history
+// of the channel as well. The thread parent is sent as changed message,
+// because its reply count has changed.
+func (f *FakeService) EmitReply(clientID string, channelID string, threadTimestamp string, userID string, text string, broadcast bool) {
+	f.mu.Lock()
+	msg := FixtureMessage{
+		User:            userID,
+		Text:            text,
+		Timestamp:       f.nextTimestamp(),
+		ThreadTimestamp: threadTimestamp,
+		Broadcast:       broadcast,
+	}
+	key := messageKey(channelID, threadTimestamp)
+	f.replies[key] = append(f.replies[key], msg)
+	if broadcast {
+		f.history[channelID] = append(f.history[channelID], msg)
+	}
+	message := f.createMessage(clientID, channelID, msg)
+
+	var parent *Message
+	if i := f.findMessage(channelID, threadTimestamp); i >= 0 && threadTimestamp != "" {
+		p := f.createMessage(clientID, channelID, f.history[channelID][i])
+		parent = &p
+	}
+	f.mu.Unlock()
+
+	f.events <- Event{
+		ClientID: clientID,
+		Data: &MessageEvent{
+			ChannelID: channelID,
+			UserID:    userID,
+			Message:   message,
+		},
+	}
+
+	if parent != nil {
+		f.events <- Event{
+			ClientID: clientID,
+			Data: &MessageChangedEvent{
+				ChannelID: channelID,
+				Message:   *parent,
+			},
+		}
+	}
+}
+
+// EmitEdit changes the text of a message in the history of a channel and
+// sends it as an edited message. When timestamp is empty the last message
+// of the channel is edited.
+func (f *FakeService) EmitEdit(clientID string, channelID string, timestamp string, text string) {
+	f.mu.Lock()
+	i := f.findMessage(channelID, timestamp)
+	if i < 0 {
+		f.mu.Unlock()
+		return
+	}
+	f.history[channelID][i].Text = text
+	message := f.createMessage(clientID, channelID, f.history[channelID][i])
+	message.Edited = true
+	f.mu.Unlock()
+
+	f.events <- Event{
+		ClientID: clientID,
+		Data: &MessageChangedEvent{
+			ChannelID: channelID,
+			Message:   message,
+		},
+	}
+}
+
+// EmitDelete removes a message from the history of a channel and sends it
+// as a deleted message. When timestamp is empty the last message of the
+// channel is deleted.
+func (f *FakeService) EmitDelete(clientID string, channelID string, timestamp string) {
+	f.mu.Lock()
+	i := f.findMessage(channelID, timestamp)
+	if i < 0 {
+		f.mu.Unlock()
+		return
+	}
+	history := f.history[channelID]
+	timestamp = history[i].Timestamp
+	f.history[channelID] = append(history[:i:i], history[i+1:]...)
+	if oldest, ok := f.oldest[channelID]; ok && oldest > i {
+		f.oldest[channelID] = oldest - 1
+	}
+	f.mu.Unlock()
+
+	f.events <- Event{
+		ClientID: clientID,
+		Data: &MessageDeletedEvent{
+			ChannelID: channelID,
+			Timestamp: timestamp,
+		},
+	}
+}
+
+// EmitReaction adds or removes the reaction name of userID to a message
+// of a channel and sends it as an incoming reaction. When timestamp is
+// empty the last message of the channel is used.
+func (f *FakeService) EmitReaction(clientID string, channelID string, timestamp string, userID string, name string, added bool) {
+	f.mu.Lock()
+	i := f.findMessage(channelID, timestamp)
+	if i < 0 {
+		f.mu.Unlock()
+		return
+	}
+	timestamp = f.history[channelID][i].Timestamp
+
+	key := messageKey(channelID, timestamp)
+	message := Message{Reactions: f.reactions[key]}
+	if added {
+		message.AddReaction(name, userID)
+	} else {
+		message.RemoveReaction(name, userID)
+	}
+	f.reactions[key] = message.Reactions
+	f.mu.Unlock()
+
+	var data interface{}
+	if added {
+		data = &ReactionAddedEvent{channelID, timestamp, userID, name}
+	} else {
+		data = &ReactionRemovedEvent{channelID, timestamp, userID, name}
+	}
+	f.events <- Event{ClientID: clientID, Data: data}
+}
+
+// findMessage returns the index in the history of a channel of the message
+// with timestamp, or of the last message when timestamp is empty. It
+// returns -1 when there is no such message. The caller must hold f.mu.
+func (f *FakeService) findMessage(channelID string, timestamp string) int {
+	history := f.history[channelID]
+	if timestamp == "" {
+		return len(history) - 1
+	}
+	for i := range history {
+		if history[i].Timestamp == timestamp {
+			return i
+		}
+	}
+	return -1
+}
+
+// nextTimestamp generates a unique slack-like message timestamp
+func (f *FakeService) nextTimestamp() string {
+	f.sequence++
+	return fmt.Sprintf("%d.%06d", time.Now().Unix(), f.sequence)
+}
+
+// createMessage creates a Message of a FixtureMessage of a channel. The
+// caller must hold f.mu.
+func (f *FakeService) createMessage(clientID string, channelID string, msg FixtureMessage) Message {
+	floatTime, err := strconv.ParseFloat(msg.Timestamp, 64)
+	if err != nil {
+		floatTime = 0.0
+	}
+
+	message := Message{
+		Timestamp:       msg.Timestamp,
+		Time:            time.Unix(int64(floatTime), 0),
+		UserID:          msg.User,
+		Name:            f.userName(clientID, msg.User),
+		Text:            msg.Text,
+		ThreadTimestamp: msg.ThreadTimestamp,
+		ReplyCount:      len(f.replies[messageKey(channelID, msg.Timestamp)]),
+		Reactions:       f.reactions[messageKey(channelID, msg.Timestamp)],
+	}
+	if msg.Broadcast {
+		message.SubType = "thread_broadcast"
+	}
+
+	var blocks []slackBlock
+	if err := json.Unmarshal(msg.Blocks, &blocks); err == nil {
+		message.Blocks = createBlocks(blocks)
+	}
+
+	for _, file := range msg.Files {
+		message.SubType = "file_share"
+		message.Files = append(message.Files, createFixtureFile(file))
+	}
+
+	message.Mentions = resolveMentions(message.mrkdwn(), func(kind string, id string) string {
+		switch kind {
+		case "@":
+			return f.teams[clientID].Users[id]
+		case "#":
+			if channel, ok := f.unjoined[id]; ok {
+				return channel.Name
+			}
+			return f.joinedChannels[id].Name
+		}
+		return ""
+	})
+	return message
+}
+
+// createFixtureFile creates the File of a FixtureFile, the attributes that
+// are omitted are derived from the name and the content of the file
+func createFixtureFile(file FixtureFile) File {
+	result := File{
+		ID:       file.ID,
+		Name:     file.Name,
+		Title:    file.Title,
+		Mimetype: file.Mimetype,
+		Filetype: file.Filetype,
+		Size:     file.Size,
+	}
+	if result.Title == "" {
+		result.Title = file.Name
+	}
+	if result.Mimetype == "" {
+		result.Mimetype = http.DetectContentType([]byte(file.Content))
+	}
+	if result.Filetype == "" {
+		result.Filetype = strings.TrimPrefix(path.Ext(file.Name), ".")
+	}
+	if result.Filetype == "" {
+		result.Filetype = "text"
+	}
+	if result.Size == 0 {
+		result.Size = len(file.Content)
+	}
+	result.PrettyType = strings.ToUpper(result.Filetype)
+
+	return result
+}
+
+// messageKey is the key of the message with timestamp in a channel, the
+// replies and reactions of a message are kept by it
+func messageKey(channelID string, timestamp string) string {
+	return channelID + "/" + timestamp
+}
+
+func (f *FakeService) userName(clientID string, userID string) string {
+	name, ok := f.teams[clientID].Users[userID]
+	if !ok || name == "" {
+		return "unknown"
+	}
+	return name
+}
+
+// GetClientIDs returns the identifiers of all teams in the fixtures
+func (f *FakeService) GetClientIDs() []string {
+	var clientIDs []string
+	for clientID := range f.teams {
+		clientIDs = append(clientIDs, clientID)
+	}
+	sort.Strings(clientIDs)
+	return clientIDs
+}
+
+// GetChannelList returns a list of all channels
+func (f *FakeService) GetChannelList() []Channel {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var result Channels
+	for _, channel := range f.joinedChannels {
+		result = append(result, channel)
+	}
+	return result
+}
+
+// GetUnjoinedChannels returns the channels of the fixtures that can be
+// joined
+func (f *FakeService) GetUnjoinedChannels() []Channel {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var result Channels
+	for _, channel := range f.unjoined {
+		result = append(result, channel)
+	}
+	return result
+}
+
+// JoinChannel moves a channel that can be joined to the joined channels
+func (f *FakeService) JoinChannel(channelID string) (Channel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	channel, ok := f.unjoined[channelID]
+	if !ok {
+		return Channel{}, fmt.Errorf("channel %s can't be joined", channelID)
+	}
+
+	channel.MemberCount++
+	f.joinedChannels[channelID] = channel
+	delete(f.unjoined, channelID)
+	return channel, nil
+}
+
+// LeaveChannel moves a joined channel to the channels that can be joined
+func (f *FakeService) LeaveChannel(channelID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	channel, ok := f.joinedChannels[channelID]
+	if !ok || channel.ChannelType != CHANNEL {
+		return fmt.Errorf("channel %s can't be left", channelID)
+	}
+
+	if channel.MemberCount > 0 {
+		channel.MemberCount--
+	}
+	f.unjoined[channelID] = channel
+	delete(f.joinedChannels, channelID)
+	return nil
+}
+
+// CreateChannel adds a new channel to the team identified by clientID
+func (f *FakeService) CreateChannel(clientID string, name string, private bool) (Channel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.teams[clientID]; !ok {
+		return Channel{}, fmt.Errorf("unknown team %s", clientID)
+	}
+	for _, channel := range f.joinedChannels {
+		if channel.ClientID == clientID && channel.ChannelType != IM && channel.Name == name {
+			return Channel{}, fmt.Errorf("channel %s exists already", name)
+		}
+	}
+
+	chn := FixtureChannel{ID: f.nextChannelID("C"), Name: name, Type: "channel", Members: 1}
+	channelType := CHANNEL
+	if private {
+		chn.ID, chn.Type = f.nextChannelID("G"), "group"
+		channelType = GROUP
+	}
+
+	channel := Channel{chn.ID, chn.Name, "", chn, clientID, channelType, chn.Members}
+	f.joinedChannels[chn.ID] = channel
+	return channel, nil
+}
+
+// OpenConversation returns the im channel with the user called
+// userNames[0], or the group with all users called userNames when there
+// are more. The channel is added when it doesn't exist yet.
+func (f *FakeService) OpenConversation(clientID string, userNames []string) (Channel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	team, ok := f.teams[clientID]
+	if !ok {
+		return Channel{}, fmt.Errorf("unknown team %s", clientID)
+	}
+	if len(userNames) == 0 {
+		return Channel{}, fmt.Errorf("no users to open a conversation with")
+	}
+	for _, name := range userNames {
+		if !hasUser(team, name) {
+			return Channel{}, fmt.Errorf("unknown user %s", name)
+		}
+	}
+
+	// Group names resemble those of slack, e.g. mpdm-bob--me-1
+	chn := FixtureChannel{Name: userNames[0], Type: "im", Members: 2}
+	channelType, prefix := IM, "D"
+	if len(userNames) > 1 {
+		names := append([]string{}, userNames...)
+		names = append(names, team.Users[team.CurrentUserID])
+		chn.Name = fmt.Sprintf("mpdm-%s-1", strings.Join(names, "--"))
+		chn.Type, chn.Members = "group", len(names)
+		channelType, prefix = GROUP, "G"
+	}
+
+	for _, channel := range f.joinedChannels {
+		if channel.ClientID == clientID && channel.ChannelType == channelType && channel.Name == chn.Name {
+			return channel, nil
+		}
+	}
+
+	chn.ID = f.nextChannelID(prefix)
+	channel := Channel{chn.ID, chn.Name, "", chn, clientID, channelType, chn.Members}
+	f.joinedChannels[chn.ID] = channel
+	return channel, nil
+}
+
+// hasUser returns true when the team has a user called name
+func hasUser(team FixtureTeam, name string) bool {
+	for _, userName := range team.Users {
+		if userName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// nextChannelID generates a channel ID starting with prefix that isn't
+// used by any channel. The caller must hold f.mu.
+func (f *FakeService) nextChannelID(prefix string) string {
+	for {
+		f.sequence++
+		id := fmt.Sprintf("%s%d", prefix, f.sequence)
+		_, joined := f.joinedChannels[id]
+		_, unjoined := f.unjoined[id]
+		if !joined && !unjoined {
+			return id
+		}
+	}
+}
+
+// SetChannelTopic replaces the topic of a channel or group
+func (f *FakeService) SetChannelTopic(channelID string, topic string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	channel, ok := f.joinedChannels[channelID]
+	if !ok || channel.ChannelType == IM {
+		return fmt.Errorf("channel %s doesn't have a topic", channelID)
+	}
+
+	channel.Topic = topic
+	f.joinedChannels[channelID] = channel
+	return nil
+}
+
+// GetChannelName returns the channel name
+func (f *FakeService) GetChannelName(channelID string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.joinedChannels[channelID].Name
+}
+
+// GetChannelTopic returns the channel topic
+func (f *FakeService) GetChannelTopic(channelID string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.joinedChannels[channelID].Topic
+}
+
+// GetMessages returns the last count messages of the history of a channel
+func (f *FakeService) GetMessages(channelID string, count int) []Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	history := f.history[channelID]
+	start := len(history) - count
+	if start < 0 {
+		start = 0
+	}
+
+	return f.showMessages(channelID, start, len(history))
+}
+
+// GetOlderMessages returns the count messages preceding the oldest message
+// returned so far
+func (f *FakeService) GetOlderMessages(channelID string, count int) ([]Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	end, ok := f.oldest[channelID]
+	if !ok {
+		return nil, nil
+	}
+	start := end - count
+	if start < 0 {
+		start = 0
+	}
+
+	return f.showMessages(channelID, start, end), nil
+}
+
+// showMessages creates the messages history[start:end] of a channel and
+// remembers start as the oldest message returned. The caller must hold
+// f.mu.
+func (f *FakeService) showMessages(channelID string, start int, end int) []Message {
+	channel := f.joinedChannels[channelID]
+	f.oldest[channelID] = start
+
+	var messages []Message
+	for _, msg := range f.history[channelID][start:end] {
+		messages = append(messages, f.createMessage(channel.ClientID, channelID, msg))
+	}
+	return messages
+}
+
+// GetCachedMessages returns the same as GetMessages, because the
+// FakeService keeps all history in memory
+func (f *FakeService) GetCachedMessages(channelID string, count int) []Message {
+	return f.GetMessages(channelID, count)
+}
+
+// SendMessage adds the message to the history of the channel and echoes
+// it back as an incoming message, like the RTM API does.
+func (f *FakeService) SendMessage(channelID string, message string) {
+	f.mu.Lock()
+	clientID := f.joinedChannels[channelID].ClientID
+	f.mu.Unlock()
+
+	f.Emit(clientID, channelID, f.GetCurrentUserID(clientID), message)
+}
+
+// UploadFile reads the file and echoes it back as an incoming message
+// sharing the file, like the RTM API does
+func (f *FakeService) UploadFile(channelID string, filename string, r io.Reader, comment string) error {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	clientID := f.joinedChannels[channelID].ClientID
+	msg := FixtureMessage{
+		User:      f.teams[clientID].CurrentUserID,
+		Text:      comment,
+		Timestamp: f.nextTimestamp(),
+		Files:     []FixtureFile{{Name: filename, Content: string(content)}},
+	}
+	msg.Files = f.loadFiles(msg)
+	f.mu.Unlock()
+
+	f.emit(clientID, channelID, msg)
+	return nil
+}
+
+// DownloadFile writes the content of a file shared in the fixtures or
+// uploaded to w
+func (f *FakeService) DownloadFile(channelID string, file File, w io.Writer) error {
+	f.mu.Lock()
+	shared, ok := f.files[file.ID]
+	f.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("file %s not found", file.ID)
+	}
+
+	_, err := io.WriteString(w, shared.Content)
+	return err
+}
+
+// GetThreadReplies returns the parent message of a thread followed by its
+// replies
+func (f *FakeService) GetThreadReplies(channelID string, threadTimestamp string) ([]Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	channel := f.joinedChannels[channelID]
+
+	var messages []Message
+	if i := f.findMessage(channelID, threadTimestamp); i >= 0 && threadTimestamp != "" {
+		messages = append(messages, f.createMessage(channel.ClientID, channelID, f.history[channelID][i]))
+	}
+	for _, msg := range f.replies[messageKey(channelID, threadTimestamp)] {
+		messages = append(messages, f.createMessage(channel.ClientID, channelID, msg))
+	}
+	return messages, nil
+}
+
+// SendReply adds the reply to the thread and echoes it back as an incoming
+// message, like the RTM API does.
+func (f *FakeService) SendReply(channelID string, threadTimestamp string, message string, broadcast bool) {
+	f.mu.Lock()
+	clientID := f.joinedChannels[channelID].ClientID
+	f.mu.Unlock()
+
+	f.EmitReply(clientID, channelID, threadTimestamp, f.GetCurrentUserID(clientID), message, broadcast)
+}
+
+// UpdateMessage changes the text of a message and echoes the change back,
+// like the RTM API does
+func (f *FakeService) UpdateMessage(channelID string, timestamp string, message string) error {
+	f.mu.Lock()
+	clientID := f.joinedChannels[channelID].ClientID
+	found := timestamp != "" && f.findMessage(channelID, timestamp) >= 0
+	f.mu.Unlock()
+
+	if !found {
+		return fmt.Errorf("message %s not found in %s", timestamp, channelID)
+	}
+	f.EmitEdit(clientID, channelID, timestamp, message)
+	return nil
+}
+
+// DeleteMessage removes a message and echoes the deletion back, like the
+// RTM API does
+func (f *FakeService) DeleteMessage(channelID string, timestamp string) error {
+	f.mu.Lock()
+	clientID := f.joinedChannels[channelID].ClientID
+	found := timestamp != "" && f.findMessage(channelID, timestamp) >= 0
+	f.mu.Unlock()
+
+	if !found {
+		return fmt.Errorf("message %s not found in %s", timestamp, channelID)
+	}
+	f.EmitDelete(clientID, channelID, timestamp)
+	return nil
+}
+
+// AddReaction adds a reaction of the current user to a message and echoes
+// it back, like the RTM API does
+func (f *FakeService) AddReaction(channelID string, timestamp string, name string) error {
+	return f.react(channelID, timestamp, name, true)
+}
+
+// RemoveReaction removes a reaction of the current user from a message
+// and echoes it back, like the RTM API does
+func (f *FakeService) RemoveReaction(channelID string, timestamp string, name string) error {
+	return f.react(channelID, timestamp, name, false)
+}
+
+func (f *FakeService) react(channelID string, timestamp string, name string, added bool) error {
+	f.mu.Lock()
+	clientID := f.joinedChannels[channelID].ClientID
+	found := timestamp != "" && f.findMessage(channelID, timestamp) >= 0
+	f.mu.Unlock()
+
+	if !found {
+		return fmt.Errorf("message %s not found in %s", timestamp, channelID)
+	}
+	f.EmitReaction(clientID, channelID, timestamp, f.GetCurrentUserID(clientID), name, added)
+	return nil
+}
+
+// SetChannelReadMark is a no-op for the FakeService
+func (f *FakeService) SetChannelReadMark(channelID string) {}
+
+// GetCurrentUserID returns the current user ID
+func (f *FakeService) GetCurrentUserID(clientID string) string {
+	return f.teams[clientID].CurrentUserID
+}
+
+// GetUserName returns the name of the user identified by userID
+func (f *FakeService) GetUserName(clientID string, userID string) string {
+	return f.userName(clientID, userID)
+}
+
+// GetUserNames returns the names of the users of the team identified by
+// clientID
+func (f *FakeService) GetUserNames(clientID string) []string {
+	var names []string
+	for _, name := range f.teams[clientID].Users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetCustomEmoji returns the custom emoji of the fixtures, which have the
+// same format as the emoji.list response of slack
+func (f *FakeService) GetCustomEmoji(clientID string) map[string]string {
+	return resolveCustomEmoji(f.teams[clientID].Emoji)
+}
+
+// IncomingEvents returns the stream of scripted and echoed messages
+func (f *FakeService) IncomingEvents() <-chan Event {
+	return f.events
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// linkRegexp matches the links in the text of a message, which slack
+// formats as <https://example.com> or <https://example.com|example.com>
+var linkRegexp = regexp.MustCompile(`<((?:https?|ftp|mailto):[^|>]+)(?:\|[^>]*)?>`)
+
+// Message is a message of a channel, it is created by a Backend and
+// rendered by the Chat component
+type Message struct {
+	// Timestamp is the slack timestamp (ts) of the message, which is
+	// unique within a channel
+	Timestamp string
+	Time      time.Time
+
+	UserID string
+	Name   string // resolved name of the user or bot
+
+	Text    string
+	SubType string
+
+	// Mentions maps the IDs of the users, channels and user groups
+	// mentioned in Text to their names
+	Mentions map[string]string
+
+	// ThreadTimestamp is the timestamp of the parent message when the
+	// message is part of a thread
+	ThreadTimestamp string
+	ReplyCount      int // number of replies when the message is a thread parent
+
+	Edited      bool
+	Deleted     bool
+	Reactions   []Reaction
+	Attachments []Attachment
+	Files       []File
+	Blocks      []Block
+}
+
+// IsThreadReply returns true when the message is a reply in a thread that
+// isn't broadcast to the channel
+func (m Message) IsThreadReply() bool {
+	return m.ThreadTimestamp != "" &&
+		m.ThreadTimestamp != m.Timestamp &&
+		m.SubType != "thread_broadcast"
+}
+
+// Spans returns the text of the message as styled spans, see ParseMrkdwn
+func (m Message) Spans() []Span {
+	return ParseMrkdwn(m.Text, m.Mentions)
+}
+
+// mrkdwn returns the texts of the message, its attachments and its blocks
+// that may contain mrkdwn, separated by newlines
+func (m Message) mrkdwn() string {
+	texts := []string{m.Text}
+	for _, att := range m.Attachments {
+		texts = append(texts, att.Pretext, att.Text, att.Footer)
+		for _, field := range att.Fields {
+			texts = append(texts, field.Value)
+		}
+	}
+	for _, block := range m.Blocks {
+		texts = append(texts, block.Text.Text)
+		for _, text := range append(block.Fields, block.Elements...) {
+			texts = append(texts, text.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// Links returns the URLs linked to in the text of the message
+func (m Message) Links() []string {
+	var links []string
+	for _, match := range linkRegexp.FindAllStringSubmatch(m.Text, -1) {
+		links = append(links, match[1])
+	}
+	return links
+}
+
+// AddReaction adds the reaction name of userID to the message
+func (m *Message) AddReaction(name string, userID string) {
+	// Copy the reactions, the slice may be shared with other copies of
+	// the message
+	m.Reactions = append([]Reaction(nil), m.Reactions...)
+
+	for i := range m.Reactions {
+		if m.Reactions[i].Name == name {
+			if !m.Reactions[i].HasUser(userID) {
+				m.Reactions[i].Users = append(append([]string(nil), m.Reactions[i].Users...), userID)
+				m.Reactions[i].Count++
+			}
+			return
+		}
+	}
+	m.Reactions = append(m.Reactions, Reaction{Name: name, Count: 1, Users: []string{userID}})
+}
+
+// RemoveReaction removes the reaction name of userID from the message
+func (m *Message) RemoveReaction(name string, userID string) {
+	var reactions []Reaction
+	for _, reaction := range m.Reactions {
+		if reaction.Name == name && reaction.HasUser(userID) {
+			var users []string
+			for _, user := range reaction.Users {
+				if user != userID {
+					users = append(users, user)
+				}
+			}
+			reaction.Users = users
+			reaction.Count--
+		}
+
+		if reaction.Count > 0 {
+			reactions = append(reactions, reaction)
+		}
+	}
+	m.Reactions = reactions
+}
+
+// Reaction is an emoji reaction on a message
+type Reaction struct {
+	Name  string
+	Count int
+	Users []string
+}
+
+// HasUser returns true when userID is one of the users that reacted
+func (r Reaction) HasUser(userID string) bool {
+	for _, user := range r.Users {
+		if user == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Attachment is an attachment of a message, mostly used by bots
+type Attachment struct {
+	Color   string
+	Pretext string
+	Title   string
+	Text    string
+	Footer  string
+	Fields  []AttachmentField
+}
+
+// AttachmentField is a field of an Attachment
+type AttachmentField struct {
+	Title string
+	Value string
+	Short bool
+}
+
+// File is a file shared in a message
+type File struct {
+	ID         string
+	Name       string
+	Title      string
+	Mimetype   string
+	Filetype   string
+	PrettyType string
+	Size       int
+	URLPrivate string
+	Mode       string // hosted, external, snippet or post
+}
+
+// IsText returns true when the file is a snippet or another text file,
+// which can be shown in the terminal
+func (f File) IsText() bool {
+	return f.Mode == "snippet" || strings.HasPrefix(f.Mimetype, "text/")
+}
@@ -0,0 +1,303 @@
+package service
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// mentionRegexp matches the mentions of users, channels and user groups,
+// e.g. <@U1234>, <#C1234|general> or <!subteam^S1234|@team>
+var mentionRegexp = regexp.MustCompile(`<(@|#|!subteam\^)(\w+)(?:\|[^>]*)?>`)
+
+// Style is the style of a Span, styles are combined by or-ing them, e.g.
+// StyleBold | StyleItalic
+type Style uint16
+
+const (
+	// StyleBold is text between asterisks, *bold*
+	StyleBold Style = 1 << iota
+	// StyleItalic is text between underscores, _italic_
+	StyleItalic
+	// StyleStrike is text between tildes, ~strike~
+	StyleStrike
+	// StyleCode is text between backticks, `code`
+	StyleCode
+	// StyleCodeBlock is text between triple backticks, which may span
+	// multiple lines
+	StyleCodeBlock
+	// StyleQuote is text on a line starting with >, or on any line
+	// following >>>
+	StyleQuote
+	// StyleLink is the label of a link, Span.URL holds its target
+	StyleLink
+	// StyleMention is a mention of a user, channel or group, e.g. @here
+	StyleMention
+)
+
+// Span is a piece of the text of a message with a single style. The text
+// may contain newlines.
+type Span struct {
+	Text  string
+	Style Style
+	URL   string // target of a link
+
+	// ID is the ID of the mentioned user, channel or user group, or
+	// "here", "channel" or "everyone" for the special mentions
+	ID string
+}
+
+// IsBroadcast returns true when the span is a mention of everyone in the
+// channel, e.g. @here
+func (s Span) IsBroadcast() bool {
+	return s.ID == "here" || s.ID == "channel" || s.ID == "everyone"
+}
+
+// resolveMentions returns the names of the users, channels and user
+// groups mentioned in text keyed by their ID. resolve returns the name
+// for an ID, kind is "@" for users, "#" for channels and "!subteam^" for
+// user groups. IDs resolve can't find a name for are left out.
+func resolveMentions(text string, resolve func(kind string, id string) string) map[string]string {
+	var mentions map[string]string
+	for _, match := range mentionRegexp.FindAllStringSubmatch(text, -1) {
+		if name := resolve(match[1], match[2]); name != "" {
+			if mentions == nil {
+				mentions = make(map[string]string)
+			}
+			mentions[match[2]] = name
+		}
+	}
+	return mentions
+}
+
+// ParseMrkdwn splits the text of a message, which is formatted in the
+// mrkdwn markup of slack, into styled spans. Markup that isn't closed is
+// kept as is. Mentions are named after mentions, which maps IDs to names,
+// or else after their label.
+func ParseMrkdwn(text string, mentions map[string]string) []Span {
+	var spans []Span
+
+	for text != "" {
+		start := strings.Index(text, "```")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(text[start+3:], "```")
+		if end < 0 {
+			break
+		}
+		end += start + 3
+
+		spans = append(spans, parseLines(text[:start], mentions)...)
+
+		// A code block is shown on lines of its own
+		if len(spans) > 0 && !strings.HasSuffix(spans[len(spans)-1].Text, "\n") {
+			spans = append(spans, Span{Text: "\n"})
+		}
+		code := strings.Trim(text[start+3:end], "\n")
+		spans = append(spans, Span{Text: html.UnescapeString(code), Style: StyleCodeBlock})
+
+		text = text[end+3:]
+		if text != "" && !strings.HasPrefix(text, "\n") {
+			spans = append(spans, Span{Text: "\n"})
+		}
+	}
+
+	return append(spans, parseLines(text, mentions)...)
+}
+
+// parseLines parses text without code blocks line by line, as block
+// quotes apply to whole lines
+func parseLines(text string, mentions map[string]string) []Span {
+	if text == "" {
+		return nil
+	}
+
+	var spans []Span
+	quoteAll := false
+	for i, line := range strings.Split(text, "\n") {
+		if i > 0 {
+			spans = append(spans, Span{Text: "\n"})
+		}
+
+		var style Style
+		switch {
+		case quoteAll:
+			style = StyleQuote
+		case strings.HasPrefix(line, "&gt;&gt;&gt;"):
+			quoteAll = true
+			style = StyleQuote
+			line = strings.TrimPrefix(line, "&gt;&gt;&gt;")
+		case strings.HasPrefix(line, "&gt;"):
+			style = StyleQuote
+			line = strings.TrimPrefix(line, "&gt;")
+		}
+		if style == StyleQuote {
+			line = strings.TrimPrefix(line, " ")
+		}
+
+		spans = append(spans, parseInline(line, style, mentions)...)
+	}
+	return spans
+}
+
+// parseInline parses the text of a single line, style is added to the
+// style of every span
+func parseInline(text string, style Style, mentions map[string]string) []Span {
+	var spans []Span
+
+	plain := 0
+	flush := func(end int) {
+		if end > plain {
+			spans = append(spans, Span{
+				Text:  html.UnescapeString(text[plain:end]),
+				Style: style,
+			})
+		}
+	}
+
+	for i := 0; i < len(text); {
+		switch text[i] {
+		case '`':
+			end := strings.IndexByte(text[i+1:], '`')
+			if end <= 0 {
+				break
+			}
+			end += i + 1
+
+			flush(i)
+			spans = append(spans, Span{
+				Text:  html.UnescapeString(text[i+1 : end]),
+				Style: style | StyleCode,
+			})
+			i = end + 1
+			plain = i
+			continue
+		case '<':
+			end := strings.IndexByte(text[i+1:], '>')
+			if end <= 0 {
+				break
+			}
+			end += i + 1
+
+			flush(i)
+			span := parseAngle(text[i+1:end], mentions)
+			span.Style |= style
+			spans = append(spans, span)
+			i = end + 1
+			plain = i
+			continue
+		case '*', '_', '~':
+			end := closingMarker(text, i)
+			if end < 0 {
+				break
+			}
+
+			flush(i)
+			spans = append(spans, parseInline(text[i+1:end], style|markerStyle(text[i]), mentions)...)
+			i = end + 1
+			plain = i
+			continue
+		}
+		i++
+	}
+	flush(len(text))
+
+	return spans
+}
+
+// markerStyle returns the style of the text between marker
+func markerStyle(marker byte) Style {
+	switch marker {
+	case '*':
+		return StyleBold
+	case '_':
+		return StyleItalic
+	default:
+		return StyleStrike
+	}
+}
+
+// closingMarker returns the index of the marker that closes the marker at
+// index start of text, or -1 when there is none. Like slack, markers only
+// count at word boundaries and the text in between can't start or end
+// with a space, so snake_case_names and 2*3*4 are left alone.
+func closingMarker(text string, start int) int {
+	marker := text[start]
+
+	if start > 0 && isWordByte(text[start-1]) {
+		return -1
+	}
+	if start+1 >= len(text) || text[start+1] == ' ' || text[start+1] == marker {
+		return -1
+	}
+
+	for end := start + 2; end < len(text); end++ {
+		if text[end] != marker || text[end-1] == ' ' {
+			continue
+		}
+		if end+1 < len(text) && isWordByte(text[end+1]) {
+			continue
+		}
+		return end
+	}
+	return -1
+}
+
+// isWordByte returns true when b is part of a word, bytes of multibyte
+// characters are considered to be part of a word
+func isWordByte(b byte) bool {
+	return b >= 0x80 || unicode.IsLetter(rune(b)) || unicode.IsDigit(rune(b))
+}
+
+// parseAngle parses the contents of <...>, which slack uses for links,
+// mentions and special commands:
+//
+//	<https://example.com|label>  link
+//	<@U1234|erroneousboat>        user
+//	<#C1234|general>              channel
+//	<!subteam^S1234|@team>        user group
+//	<!here>, <!channel>           special mentions
+func parseAngle(content string, mentions map[string]string) Span {
+	target, label := content, ""
+	if i := strings.IndexByte(content, '|'); i >= 0 {
+		target, label = content[:i], content[i+1:]
+	}
+	label = html.UnescapeString(label)
+
+	// mention creates the span of a mention of id, prefixed with kind
+	mention := func(kind string, id string) Span {
+		name, ok := mentions[id]
+		if !ok {
+			name = strings.TrimPrefix(label, "@")
+		}
+		if name == "" {
+			name = id
+		}
+		return Span{Text: kind + name, Style: StyleMention, ID: id}
+	}
+
+	switch {
+	case strings.HasPrefix(target, "@"):
+		return mention("@", target[1:])
+	case strings.HasPrefix(target, "#"):
+		return mention("#", target[1:])
+	case strings.HasPrefix(target, "!subteam^"):
+		return mention("@", strings.TrimPrefix(target, "!subteam^"))
+	case target == "!here" || target == "!channel" || target == "!everyone":
+		return Span{Text: "@" + target[1:], Style: StyleMention, ID: target[1:]}
+	case strings.HasPrefix(target, "!"):
+		// Other commands, like dates, come with a fallback text
+		if label == "" {
+			label = target[1:]
+		}
+		return Span{Text: label}
+	}
+
+	url := html.UnescapeString(target)
+	if label == "" {
+		label = strings.TrimPrefix(url, "mailto:")
+	}
+	return Span{Text: label, Style: StyleLink, URL: url}
+}
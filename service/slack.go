@@ -2,24 +2,43 @@ package service
 
 import (
 	"fmt"
-	"log"
+	"io"
+	"net/url"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	slack "github.com/nlopes/slack"
-	"regexp"
 )
 
 // SlackService is the service that manages slack connections
 type SlackService struct {
-	Client           map[string]*slack.Client
-	RTM              map[string]*slack.RTM
+	client           map[string]*slack.Client
+	tokens           map[string]string
+	rtm              map[string]*slack.RTM
+	events           chan Event
 	joinedChannels   map[string]Channel
 	unjoinedChannels map[string]Channel
 	userCache        map[string]string
+	userIDs          map[string]map[string]string // user IDs by name per team
 	currentUserID    map[string]string
+	cache            *MessageCache
+	synced           map[string]bool
+	oldest           map[string]string
+	emoji            map[string]map[string]string
+	mu               sync.Mutex // guards synced, oldest and emoji
+
+	// channelsMu guards joinedChannels, unjoinedChannels and userCache,
+	// which are read by the RTM goroutines as well
+	channelsMu sync.RWMutex
 }
 
+// maxHistoryCount is the maximum number of messages slack returns for
+// a single history request
+const maxHistoryCount = 1000
+
 // Channel represents a slack channel within this app
 type Channel struct {
 	ID           string
@@ -28,6 +47,7 @@ type Channel struct {
 	SlackChannel interface{}
 	ClientID     string
 	ChannelType  ChannelType
+	MemberCount  int
 }
 
 // Channels is an array of Channel, mainly to sort
@@ -60,45 +80,255 @@ const (
 )
 
 // CreateSlackService is the constructor for the SlackService and will initialize
-// the RTM and a ClientID
-func CreateSlackService(tokens map[string]string) *SlackService {
+// the RTM and a ClientID. apiURL is the base URL of the Slack Web API, when
+// empty the default of nlopes/slack (https://slack.com/api/) is used.
+// Messages are kept in cache, which may be nil.
+//
+// nlopes/slack reads the API URL from the package variable slack.SLACK_API,
+// so it is shared by all services of the process. Services created with
+// different URLs, like by tests that run in parallel, change the URL of
+// each other.
+func CreateSlackService(tokens map[string]string, apiURL string, cache *MessageCache) (*SlackService, error) {
+	if apiURL != "" {
+		if !strings.HasSuffix(apiURL, "/") {
+			apiURL = apiURL + "/"
+		}
+		slack.SLACK_API = apiURL
+	}
+
 	svc := &SlackService{
-		Client:           make(map[string]*slack.Client),
-		RTM:              make(map[string]*slack.RTM),
+		client:           make(map[string]*slack.Client),
+		tokens:           tokens,
+		rtm:              make(map[string]*slack.RTM),
+		events:           make(chan Event, 50),
 		joinedChannels:   make(map[string]Channel),
 		unjoinedChannels: make(map[string]Channel),
 		userCache:        make(map[string]string),
+		userIDs:          make(map[string]map[string]string),
 		currentUserID:    make(map[string]string),
+		cache:            cache,
+		synced:           make(map[string]bool),
+		oldest:           make(map[string]string),
+		emoji:            make(map[string]map[string]string),
 	}
 
 	for clientID, token := range tokens {
-		svc.Client[clientID] = slack.New(token)
+		svc.client[clientID] = slack.New(token)
 
 		// Get channelUser associated with token, mainly
 		// used to identify channelUser when new messages
 		// arrives
-		authTest, err := svc.Client[clientID].AuthTest()
+		authTest, err := svc.client[clientID].AuthTest()
 		if err != nil {
-			log.Fatal("ERROR: not able to authorize client, check your connection and/or slack-token")
+			return nil, fmt.Errorf("not able to authorize client %s, check your connection and/or slack-token: %s", clientID, err)
 		}
 		svc.currentUserID[clientID] = authTest.UserID
 
 		// Create RTM
-		svc.RTM[clientID] = svc.Client[clientID].NewRTM()
-		go svc.RTM[clientID].ManageConnection()
+		svc.rtm[clientID] = svc.client[clientID].NewRTM()
+		go svc.rtm[clientID].ManageConnection()
 
 		// Creation of channelUser cache this speeds up
 		// the uncovering of usernames of messages
-		users, _ := svc.Client[clientID].GetUsers()
+		users, _ := svc.client[clientID].GetUsers()
+		svc.userIDs[clientID] = make(map[string]string)
 		for _, channelUser := range users {
 			// only add non-deleted users
 			if !channelUser.Deleted {
-				svc.userCache[channelUser.ID] = channelUser.Name
+				svc.setCachedUserName(channelUser.ID, channelUser.Name)
+				svc.userIDs[clientID][channelUser.Name] = channelUser.ID
 			}
 		}
+
+		go svc.handleIncomingEvents(clientID)
+		go svc.fetchCustomEmoji(clientID)
 	}
 
-	return svc
+	return svc, nil
+}
+
+// handleIncomingEvents translates the RTM events of a client into
+// Events and sends them to the events channel.
+func (s *SlackService) handleIncomingEvents(clientID string) {
+	for msg := range s.rtm[clientID].IncomingEvents {
+		switch ev := msg.Data.(type) {
+		case *slack.ConnectedEvent:
+			// When reconnecting we might have missed messages
+			// while we were disconnected, so the caches are not
+			// up to date anymore
+			if ev.ConnectionCount > 1 {
+				for _, channel := range s.getJoinedChannels() {
+					if channel.ClientID == clientID {
+						s.setSynced(channel.ID, false)
+					}
+				}
+			}
+
+			var unread []string
+			for _, chn := range ev.Info.Channels {
+				if chn.UnreadCountDisplay > 0 {
+					unread = append(unread, chn.ID)
+				}
+			}
+			s.events <- Event{
+				ClientID: clientID,
+				Data:     &ConnectedEvent{UnreadChannelIDs: unread},
+			}
+		case *slack.MessageEvent:
+			s.handleMessageEvent(clientID, ev)
+		case *slack.ReactionAddedEvent:
+			if ev.Item.Type != "message" {
+				continue
+			}
+			s.updateCachedReaction(clientID, ev.Item.Channel, ev.Item.Timestamp, func(message *Message) {
+				message.AddReaction(ev.Reaction, ev.User)
+			})
+
+			s.events <- Event{
+				ClientID: clientID,
+				Data: &ReactionAddedEvent{
+					ChannelID: ev.Item.Channel,
+					Timestamp: ev.Item.Timestamp,
+					UserID:    ev.User,
+					Name:      ev.Reaction,
+				},
+			}
+		case *slack.ReactionRemovedEvent:
+			if ev.Item.Type != "message" {
+				continue
+			}
+			s.updateCachedReaction(clientID, ev.Item.Channel, ev.Item.Timestamp, func(message *Message) {
+				message.RemoveReaction(ev.Reaction, ev.User)
+			})
+
+			s.events <- Event{
+				ClientID: clientID,
+				Data: &ReactionRemovedEvent{
+					ChannelID: ev.Item.Channel,
+					Timestamp: ev.Item.Timestamp,
+					UserID:    ev.User,
+					Name:      ev.Reaction,
+				},
+			}
+		}
+	}
+}
+
+// handleMessageEvent keeps the cache up to date with a message event and
+// translates it into an Event. Edits and deletions are applied to cached
+// messages as well, so channels that are not on screen stay up to date.
+func (s *SlackService) handleMessageEvent(clientID string, ev *slack.MessageEvent) {
+	switch ev.SubType {
+	case "message_changed", "message_replied":
+		if ev.SubMessage == nil {
+			return
+		}
+		changed := slackMessage{Message: slack.Message{Msg: *ev.SubMessage}}
+		if err := s.cache.Update(clientID, ev.Channel, changed); err != nil {
+			s.cacheFailed(clientID, err)
+		}
+
+		s.events <- Event{
+			ClientID: clientID,
+			Data: &MessageChangedEvent{
+				ChannelID: ev.Channel,
+				Message:   s.createMessage(changed, clientID),
+			},
+		}
+
+		if needsBlocks(changed.Message) {
+			go s.fetchBlocks(clientID, ev.Channel, changed.Message)
+		}
+	case "message_deleted":
+		if err := s.cache.Delete(clientID, ev.Channel, ev.DeletedTimestamp); err != nil {
+			s.cacheFailed(clientID, err)
+		}
+
+		s.events <- Event{
+			ClientID: clientID,
+			Data: &MessageDeletedEvent{
+				ChannelID: ev.Channel,
+				Timestamp: ev.DeletedTimestamp,
+			},
+		}
+	default:
+		if ev.Hidden {
+			return
+		}
+
+		msg := slackMessage{Message: slack.Message(*ev)}
+		message := s.createMessage(msg, clientID)
+
+		// Thread replies aren't part of the history of the channel
+		if s.isSynced(ev.Channel) && !message.IsThreadReply() {
+			if err := s.cache.Add(clientID, ev.Channel, msg); err != nil {
+				s.cacheFailed(clientID, err)
+			}
+		}
+
+		s.events <- Event{
+			ClientID: clientID,
+			Data: &MessageEvent{
+				ChannelID: ev.Channel,
+				UserID:    ev.User,
+				Message:   message,
+			},
+		}
+
+		if needsBlocks(msg.Message) {
+			go s.fetchBlocks(clientID, ev.Channel, msg.Message)
+		}
+	}
+}
+
+// updateCachedReaction applies a change of the reactions of a message to
+// the cached message. The reactions are changed through Message, so the
+// bookkeeping of users and counts lives in a single place.
+func (s *SlackService) updateCachedReaction(clientID string, channelID string, timestamp string, change func(*Message)) {
+	for _, cached := range s.cache.Messages(clientID, channelID) {
+		if cached.Timestamp != timestamp {
+			continue
+		}
+
+		var message Message
+		for _, reaction := range cached.Reactions {
+			message.Reactions = append(message.Reactions, Reaction{
+				Name:  reaction.Name,
+				Count: reaction.Count,
+				Users: reaction.Users,
+			})
+		}
+		change(&message)
+
+		cached.Reactions = nil
+		for _, reaction := range message.Reactions {
+			cached.Reactions = append(cached.Reactions, slack.ItemReaction{
+				Name:  reaction.Name,
+				Count: reaction.Count,
+				Users: reaction.Users,
+			})
+		}
+		if err := s.cache.Update(clientID, channelID, cached); err != nil {
+			s.cacheFailed(clientID, err)
+		}
+		return
+	}
+}
+
+// IncomingEvents returns the stream of events coming in from all the
+// RTM connections
+func (s *SlackService) IncomingEvents() <-chan Event {
+	return s.events
+}
+
+// GetClientIDs returns the identifiers of all configured teams
+func (s *SlackService) GetClientIDs() []string {
+	var clientIDs []string
+	for clientID := range s.client {
+		clientIDs = append(clientIDs, clientID)
+	}
+	sort.Strings(clientIDs)
+	return clientIDs
 }
 
 // updateChannels will retrieve all available channels, groups, and im channels.
@@ -109,7 +339,7 @@ func CreateSlackService(tokens map[string]string) *SlackService {
 // to the id and name of the Channel.
 func (s *SlackService) updateChannels() {
 	// FIXME Check errors
-	for currentClientID := range s.Client {
+	for currentClientID := range s.client {
 		// Channel
 		_ = s.fetchChannels(currentClientID)
 
@@ -124,12 +354,7 @@ func (s *SlackService) updateChannels() {
 // GetChannelList returns a list of all channels
 func (s *SlackService) GetChannelList() []Channel {
 	s.updateChannels()
-	var result Channels
-	for _, channel := range s.joinedChannels {
-		result = append(result, channel)
-	}
-
-	return result
+	return s.getJoinedChannels()
 }
 
 // GetCurrentUserID returns the current user ID
@@ -137,8 +362,52 @@ func (s *SlackService) GetCurrentUserID(clientID string) string {
 	return s.currentUserID[clientID]
 }
 
+// GetUserName returns the name of the user identified by userID
+func (s *SlackService) GetUserName(clientID string, userID string) string {
+	return s.getMessageUserName(slack.Message{Msg: slack.Msg{User: userID}}, clientID)
+}
+
+// GetUserNames returns the names of the users of the team identified by
+// clientID
+func (s *SlackService) GetUserNames(clientID string) []string {
+	var names []string
+	for name := range s.userIDs[clientID] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetCustomEmoji returns the custom emoji of the team identified by
+// clientID, nil until fetchCustomEmoji has fetched them
+func (s *SlackService) GetCustomEmoji(clientID string) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.emoji[clientID]
+}
+
+// fetchCustomEmoji fetches the custom emoji of the team identified by
+// clientID once, when the service is created, and sends them in a
+// CustomEmojiEvent. A team whose emoji can't be fetched gets none, the
+// shortcodes are shown as they are then.
+func (s *SlackService) fetchCustomEmoji(clientID string) {
+	emoji := make(map[string]string)
+	if list, err := s.client[clientID].GetEmoji(); err == nil {
+		emoji = resolveCustomEmoji(list)
+	}
+
+	s.mu.Lock()
+	s.emoji[clientID] = emoji
+	s.mu.Unlock()
+
+	s.events <- Event{
+		ClientID: clientID,
+		Data:     &CustomEmojiEvent{Emoji: emoji},
+	}
+}
+
 func (s *SlackService) fetchIM(currentClientID string) error {
-	slackIM, err := s.Client[currentClientID].GetIMChannels()
+	slackIM, err := s.client[currentClientID].GetIMChannels()
 	if err != nil {
 		//chans = append(chans, Channel{})
 	}
@@ -152,57 +421,272 @@ func (s *SlackService) fetchIM(currentClientID string) error {
 		// IM channel this is then probably a deleted
 		// user, because we wont add deleted users
 		// to the userCache, so we skip it
-		name, ok := s.userCache[im.User]
+		name, ok := s.getCachedUserName(im.User)
 		if ok {
-			s.joinedChannels[im.ID] = Channel{im.ID, name, "", im, currentClientID, IM}
+			s.setJoinedChannel(Channel{im.ID, name, "", im, currentClientID, IM, 2})
 		}
 	}
 	return err
 }
 
 func (s *SlackService) fetchGroups(currentClientID string) error {
-	slackGroups, err := s.Client[currentClientID].GetGroups(true)
+	slackGroups, err := s.client[currentClientID].GetGroups(true)
 	if err != nil {
 		//chans = append(chans, Channel{})
 	}
 	for _, grp := range slackGroups {
-		s.joinedChannels[grp.ID] = Channel{grp.ID, grp.Name, grp.Topic.Value, grp, currentClientID, GROUP}
+		s.setJoinedChannel(Channel{grp.ID, grp.Name, grp.Topic.Value, grp, currentClientID, GROUP, len(grp.Members)})
 	}
 	return err
 }
 
 func (s *SlackService) fetchChannels(currentClientID string) error {
-	slackChans, err := s.Client[currentClientID].GetChannels(true)
+	slackChans, err := s.client[currentClientID].GetChannels(true)
 	if err != nil {
 		//chans = append(chans, Channel{})
 	}
 	for _, chn := range slackChans {
+		// A channel may have been joined or left since the last fetch
 		if chn.IsMember {
-			s.joinedChannels[chn.ID] = Channel{chn.ID, chn.Name, chn.Topic.Value, chn, currentClientID, CHANNEL}
+			s.setJoinedChannel(createChannel(chn, currentClientID))
 		} else {
-			s.unjoinedChannels[chn.ID] = Channel{chn.ID, chn.Name, chn.Topic.Value, chn, currentClientID, CHANNEL}
+			s.setUnjoinedChannel(createChannel(chn, currentClientID))
 		}
 	}
 	return err
 }
 
+// createChannel creates a Channel from a public slack channel
+func createChannel(chn slack.Channel, clientID string) Channel {
+	return Channel{chn.ID, chn.Name, chn.Topic.Value, chn, clientID, CHANNEL, len(chn.Members)}
+}
+
+// getJoinedChannel returns the joined channel with channelID
+func (s *SlackService) getJoinedChannel(channelID string) (Channel, bool) {
+	s.channelsMu.RLock()
+	defer s.channelsMu.RUnlock()
+
+	channel, ok := s.joinedChannels[channelID]
+	return channel, ok
+}
+
+// getJoinedChannels returns the channels of all teams the user is a
+// member of, unlike GetChannelList they aren't fetched again
+func (s *SlackService) getJoinedChannels() []Channel {
+	s.channelsMu.RLock()
+	defer s.channelsMu.RUnlock()
+
+	var result Channels
+	for _, channel := range s.joinedChannels {
+		result = append(result, channel)
+	}
+	return result
+}
+
+// setJoinedChannel adds or updates a channel the user is a member of
+func (s *SlackService) setJoinedChannel(channel Channel) {
+	s.channelsMu.Lock()
+	defer s.channelsMu.Unlock()
+
+	s.joinedChannels[channel.ID] = channel
+	delete(s.unjoinedChannels, channel.ID)
+}
+
+// setUnjoinedChannel adds or updates a channel the user can join
+func (s *SlackService) setUnjoinedChannel(channel Channel) {
+	s.channelsMu.Lock()
+	defer s.channelsMu.Unlock()
+
+	s.unjoinedChannels[channel.ID] = channel
+	delete(s.joinedChannels, channel.ID)
+}
+
+// GetUnjoinedChannels returns the public channels of all teams the user
+// isn't a member of, they are fetched again so the topics and member
+// counts are up to date
+func (s *SlackService) GetUnjoinedChannels() []Channel {
+	for currentClientID := range s.client {
+		_ = s.fetchChannels(currentClientID)
+	}
+
+	s.channelsMu.RLock()
+	defer s.channelsMu.RUnlock()
+
+	var result Channels
+	for _, channel := range s.unjoinedChannels {
+		result = append(result, channel)
+	}
+	return result
+}
+
+// JoinChannel will join the public channel with channelID and returns
+// it, from then on it is part of the channel list
+func (s *SlackService) JoinChannel(channelID string) (Channel, error) {
+	s.channelsMu.RLock()
+	channel, ok := s.unjoinedChannels[channelID]
+	s.channelsMu.RUnlock()
+	if !ok {
+		return Channel{}, fmt.Errorf("channel %s can't be joined", channelID)
+	}
+
+	// https://api.slack.com/methods/channels.join
+	chn, err := s.client[channel.ClientID].JoinChannel(channel.Name)
+	if err != nil {
+		return Channel{}, err
+	}
+
+	channel = createChannel(*chn, channel.ClientID)
+	s.setJoinedChannel(channel)
+	return channel, nil
+}
+
+// LeaveChannel will leave the public channel with channelID, it can be
+// joined again afterwards
+func (s *SlackService) LeaveChannel(channelID string) error {
+	channel, ok := s.getJoinedChannel(channelID)
+	if !ok || channel.ChannelType != CHANNEL {
+		return fmt.Errorf("channel %s can't be left", channelID)
+	}
+
+	// https://api.slack.com/methods/channels.leave
+	if _, err := s.client[channel.ClientID].LeaveChannel(channelID); err != nil {
+		return err
+	}
+
+	if channel.MemberCount > 0 {
+		channel.MemberCount--
+	}
+	s.setUnjoinedChannel(channel)
+	return nil
+}
+
+// CreateChannel will create a channel on the team identified by clientID
+// and returns it, a private channel is created as group
+func (s *SlackService) CreateChannel(clientID string, name string, private bool) (Channel, error) {
+	client, ok := s.client[clientID]
+	if !ok {
+		return Channel{}, fmt.Errorf("unknown team %s", clientID)
+	}
+
+	var channel Channel
+	if private {
+		// https://api.slack.com/methods/groups.create
+		grp, err := client.CreateGroup(name)
+		if err != nil {
+			return Channel{}, err
+		}
+		channel = Channel{grp.ID, grp.Name, grp.Topic.Value, *grp, clientID, GROUP, len(grp.Members)}
+	} else {
+		// https://api.slack.com/methods/channels.create
+		chn, err := client.CreateChannel(name)
+		if err != nil {
+			return Channel{}, err
+		}
+		channel = createChannel(*chn, clientID)
+	}
+
+	s.setJoinedChannel(channel)
+	return channel, nil
+}
+
+// OpenConversation will open a direct message channel with the users
+// called userNames on the team identified by clientID and returns it.
+// With more than one user a multiparty direct message channel is opened,
+// which is a group.
+func (s *SlackService) OpenConversation(clientID string, userNames []string) (Channel, error) {
+	if _, ok := s.client[clientID]; !ok {
+		return Channel{}, fmt.Errorf("unknown team %s", clientID)
+	}
+
+	var userIDs []string
+	for _, name := range userNames {
+		userID, ok := s.userIDs[clientID][name]
+		if !ok {
+			return Channel{}, fmt.Errorf("unknown user %s", name)
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	switch len(userIDs) {
+	case 0:
+		return Channel{}, fmt.Errorf("no users to open a conversation with")
+	case 1:
+		// https://api.slack.com/methods/im.open
+		_, _, channelID, err := s.client[clientID].OpenIMChannel(userIDs[0])
+		if err != nil {
+			return Channel{}, err
+		}
+		if channel, ok := s.getJoinedChannel(channelID); ok {
+			return channel, nil
+		}
+
+		im := slack.IM{IsIM: true, User: userIDs[0]}
+		im.ID = channelID
+		channel := Channel{channelID, userNames[0], "", im, clientID, IM, 2}
+		s.setJoinedChannel(channel)
+		return channel, nil
+	}
+
+	// https://api.slack.com/methods/mpim.open
+	var response struct {
+		Group slack.Group `json:"group"`
+	}
+	values := url.Values{"users": {strings.Join(userIDs, ",")}}
+	if err := s.apiCall(clientID, "mpim.open", values, &response); err != nil {
+		return Channel{}, err
+	}
+
+	grp := response.Group
+	channel := Channel{grp.ID, grp.Name, grp.Topic.Value, grp, clientID, GROUP, len(grp.Members)}
+	s.setJoinedChannel(channel)
+	return channel, nil
+}
+
+// SetChannelTopic will set the topic of a channel or group, ims don't
+// have a topic
+func (s *SlackService) SetChannelTopic(channelID string, topic string) error {
+	channel, ok := s.getJoinedChannel(channelID)
+	if !ok {
+		return fmt.Errorf("unknown channel %s", channelID)
+	}
+
+	var err error
+	switch channel.ChannelType {
+	case CHANNEL:
+		// https://api.slack.com/methods/channels.setTopic
+		topic, err = s.client[channel.ClientID].SetChannelTopic(channelID, topic)
+	case GROUP:
+		// https://api.slack.com/methods/groups.setTopic
+		topic, err = s.client[channel.ClientID].SetGroupTopic(channelID, topic)
+	default:
+		err = fmt.Errorf("channel %s doesn't have a topic", channelID)
+	}
+	if err != nil {
+		return err
+	}
+
+	channel.Topic = topic
+	s.setJoinedChannel(channel)
+	return nil
+}
+
 // SetChannelReadMark will set the read mark for a channel, group, and im
 // channel based on the current time.
 func (s *SlackService) SetChannelReadMark(channelID string) {
-	selectedChannel := s.joinedChannels[channelID]
+	selectedChannel, _ := s.getJoinedChannel(channelID)
 	switch channel := selectedChannel.SlackChannel.(type) {
 	case slack.Channel:
-		s.Client[selectedChannel.ClientID].SetChannelReadMark(
+		s.client[selectedChannel.ClientID].SetChannelReadMark(
 			channel.ID, fmt.Sprintf("%f",
 				float64(time.Now().Unix())),
 		)
 	case slack.Group:
-		s.Client[selectedChannel.ClientID].SetGroupReadMark(
+		s.client[selectedChannel.ClientID].SetGroupReadMark(
 			channel.ID, fmt.Sprintf("%f",
 				float64(time.Now().Unix())),
 		)
 	case slack.IM:
-		s.Client[selectedChannel.ClientID].MarkIMChannel(
+		s.client[selectedChannel.ClientID].MarkIMChannel(
 			channel.ID, fmt.Sprintf("%f",
 				float64(time.Now().Unix())),
 		)
@@ -211,20 +695,157 @@ func (s *SlackService) SetChannelReadMark(channelID string) {
 
 // SendMessage will send a message to a particular channel
 func (s *SlackService) SendMessage(channelID string, message string) {
-	currentChannel := s.joinedChannels[channelID]
+	currentChannel, _ := s.getJoinedChannel(channelID)
 	// https://godoc.org/github.com/nlopes/slack#PostMessageParameters
 	postParams := slack.PostMessageParameters{
 		AsUser: true,
 	}
 
 	// https://godoc.org/github.com/nlopes/slack#Client.PostMessage
-	s.Client[currentChannel.ClientID].PostMessage(channelID, message, postParams)
+	s.client[currentChannel.ClientID].PostMessage(channelID, message, postParams)
+}
+
+// UpdateMessage will replace the text of a message, the change will come
+// back as message_changed event
+func (s *SlackService) UpdateMessage(channelID string, timestamp string, message string) error {
+	currentChannel, _ := s.getJoinedChannel(channelID)
+
+	// https://api.slack.com/methods/chat.update
+	_, _, _, err := s.client[currentChannel.ClientID].UpdateMessage(channelID, timestamp, message)
+	return err
+}
+
+// UploadFile will upload a file to a channel, the message sharing it will
+// come back as message event
+func (s *SlackService) UploadFile(channelID string, filename string, r io.Reader, comment string) error {
+	currentChannel, _ := s.getJoinedChannel(channelID)
+
+	values := url.Values{
+		"channels": {channelID},
+		"filename": {filename},
+	}
+	if comment != "" {
+		values.Set("initial_comment", comment)
+	}
+
+	// https://api.slack.com/methods/files.upload
+	return s.apiUpload(currentChannel.ClientID, "files.upload", values, filename, r, nil)
+}
+
+// DownloadFile will download a file shared in a channel
+func (s *SlackService) DownloadFile(channelID string, file File, w io.Writer) error {
+	// External files are hosted elsewhere, like Google Drive, they are
+	// opened in the browser instead
+	if file.Mode == "external" {
+		return fmt.Errorf("%s is hosted outside of slack", file.Name)
+	}
+
+	currentChannel, _ := s.getJoinedChannel(channelID)
+
+	// https://api.slack.com/types/file#authentication
+	return s.apiDownload(currentChannel.ClientID, file.URLPrivate, w)
+}
+
+// DeleteMessage will delete a message, the deletion will come back as
+// message_deleted event
+func (s *SlackService) DeleteMessage(channelID string, timestamp string) error {
+	currentChannel, _ := s.getJoinedChannel(channelID)
+
+	// https://api.slack.com/methods/chat.delete
+	_, _, err := s.client[currentChannel.ClientID].DeleteMessage(channelID, timestamp)
+	return err
+}
+
+// AddReaction will add a reaction of the current user to a message, the
+// change will come back as reaction_added event
+func (s *SlackService) AddReaction(channelID string, timestamp string, name string) error {
+	currentChannel, _ := s.getJoinedChannel(channelID)
+
+	// https://api.slack.com/methods/reactions.add
+	return s.client[currentChannel.ClientID].AddReaction(
+		name, slack.NewRefToMessage(channelID, timestamp))
+}
+
+// RemoveReaction will remove a reaction of the current user from a
+// message, the change will come back as reaction_removed event
+func (s *SlackService) RemoveReaction(channelID string, timestamp string, name string) error {
+	currentChannel, _ := s.getJoinedChannel(channelID)
+
+	// https://api.slack.com/methods/reactions.remove
+	return s.client[currentChannel.ClientID].RemoveReaction(
+		name, slack.NewRefToMessage(channelID, timestamp))
+}
+
+// SendReply will send a message as a reply in a thread. nlopes/slack
+// doesn't support reply_broadcast, so broadcast replies are posted with
+// the Web API directly.
+func (s *SlackService) SendReply(channelID string, threadTimestamp string, message string, broadcast bool) {
+	currentChannel, _ := s.getJoinedChannel(channelID)
+
+	if broadcast {
+		// https://api.slack.com/methods/chat.postMessage
+		s.apiCall(currentChannel.ClientID, "chat.postMessage", url.Values{
+			"channel":         {channelID},
+			"text":            {message},
+			"as_user":         {"true"},
+			"thread_ts":       {threadTimestamp},
+			"reply_broadcast": {"true"},
+		}, nil)
+		return
+	}
+
+	postParams := slack.PostMessageParameters{
+		AsUser:          true,
+		ThreadTimestamp: threadTimestamp,
+	}
+	s.client[currentChannel.ClientID].PostMessage(channelID, message, postParams)
+}
+
+// repliesResponse is the response of conversations.replies
+type repliesResponse struct {
+	Messages         []slackMessage `json:"messages"`
+	HasMore          bool           `json:"has_more"`
+	ResponseMetadata struct {
+		NextCursor string `json:"next_cursor"`
+	} `json:"response_metadata"`
+}
+
+// GetThreadReplies will get the parent message of a thread followed by
+// all of its replies
+func (s *SlackService) GetThreadReplies(channelID string, threadTimestamp string) ([]Message, error) {
+	channel, _ := s.getJoinedChannel(channelID)
+
+	var messages []slackMessage
+	cursor := ""
+	for {
+		// https://api.slack.com/methods/conversations.replies
+		var response repliesResponse
+		err := s.apiCall(channel.ClientID, "conversations.replies", url.Values{
+			"channel": {channelID},
+			"ts":      {threadTimestamp},
+			"cursor":  {cursor},
+		}, &response)
+		if err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, response.Messages...)
+
+		cursor = response.ResponseMetadata.NextCursor
+		if !response.HasMore || cursor == "" {
+			break
+		}
+	}
+
+	return s.createMessages(messages, channel.ClientID), nil
 }
 
 // GetMessages will get messages for a channel, group or im channel delimited
-// by a count.
-func (s *SlackService) GetMessages(channelID string, count int) []string {
-	channel := s.joinedChannels[channelID]
+// by a count. When messages of the channel are cached only the messages
+// since the newest cached message are fetched.
+func (s *SlackService) GetMessages(channelID string, count int) []Message {
+	channel, _ := s.getJoinedChannel(channelID)
+
 	// https://api.slack.com/methods/channels.history
 	historyParams := slack.HistoryParameters{
 		Count:     count,
@@ -232,98 +853,345 @@ func (s *SlackService) GetMessages(channelID string, count int) []string {
 		Unreads:   false,
 	}
 
-	// https://godoc.org/github.com/nlopes/slack#History
-	history := new(slack.History)
-	var err error
-	switch chnType := channel.SlackChannel.(type) {
-	case slack.Channel:
-		history, err = s.Client[channel.ClientID].GetChannelHistory(chnType.ID, historyParams)
-		if err != nil {
-			log.Fatal(err) // FIXME
+	latest := s.cache.Latest(channel.ClientID, channelID)
+	if latest != "" {
+		historyParams.Oldest = latest
+		historyParams.Count = maxHistoryCount
+	}
+
+	history, err := s.getHistory(channel, historyParams)
+	if err != nil {
+		// Not able to reach slack, show what we've got
+		return s.GetCachedMessages(channelID, count)
+	}
+
+	// Slack returns the newest messages first
+	var messages []slackMessage
+	for i := len(history.Messages) - 1; i >= 0; i-- {
+		messages = append(messages, history.Messages[i])
+	}
+
+	if s.cache == nil {
+		return s.showMessages(channel, lastMessages(messages, count))
+	}
+
+	if latest != "" && history.HasMore {
+		// There are more new messages than we've fetched, the cache
+		// would have a gap so start over
+		err = s.cache.Replace(channel.ClientID, channelID, messages)
+	} else {
+		err = s.cache.Add(channel.ClientID, channelID, messages...)
+	}
+	if err != nil {
+		s.cacheFailed(channel.ClientID, err)
+	}
+	s.setSynced(channelID, true)
+
+	return s.GetCachedMessages(channelID, count)
+}
+
+// GetCachedMessages will get the cached messages of a channel delimited by
+// a count, without going over the network.
+func (s *SlackService) GetCachedMessages(channelID string, count int) []Message {
+	channel, _ := s.getJoinedChannel(channelID)
+
+	messages := s.cache.Messages(channel.ClientID, channelID)
+
+	return s.showMessages(channel, lastMessages(messages, count))
+}
+
+// GetOlderMessages will get the count messages that precede the oldest
+// message returned for a channel so far. Cached messages are used first,
+// the rest is fetched from slack. When no messages are returned the
+// beginning of the channel has been reached.
+func (s *SlackService) GetOlderMessages(channelID string, count int) ([]Message, error) {
+	channel, _ := s.getJoinedChannel(channelID)
+
+	oldest := s.getOldest(channelID)
+	if oldest == "" {
+		return nil, nil
+	}
+
+	var older []slackMessage
+	for _, message := range s.cache.Messages(channel.ClientID, channelID) {
+		if timestampLess(message.Timestamp, oldest) {
+			older = append(older, message)
 		}
-	case slack.Group:
-		history, err = s.Client[channel.ClientID].GetGroupHistory(chnType.ID, historyParams)
-		if err != nil {
-			log.Fatal(err) // FIXME
+	}
+
+	if len(older) < count {
+		latest := oldest
+		if len(older) > 0 {
+			latest = older[0].Timestamp
 		}
-	case slack.IM:
-		history, err = s.Client[channel.ClientID].GetIMHistory(chnType.ID, historyParams)
+
+		// https://api.slack.com/methods/channels.history
+		history, err := s.getHistory(channel, slack.HistoryParameters{
+			Latest:    latest,
+			Count:     count - len(older),
+			Inclusive: false,
+			Unreads:   false,
+		})
 		if err != nil {
-			log.Fatal(err) // FIXME
+			return nil, err
+		}
+
+		// Slack returns the newest messages first
+		var fetched []slackMessage
+		for i := len(history.Messages) - 1; i >= 0; i-- {
+			fetched = append(fetched, history.Messages[i])
+		}
+		if err := s.cache.Add(channel.ClientID, channelID, fetched...); err != nil {
+			s.cacheFailed(channel.ClientID, err)
 		}
+
+		older = append(fetched, older...)
+	}
+
+	return s.showMessages(channel, lastMessages(older, count)), nil
+}
+
+// showMessages creates the messages that will be shown for a channel and
+// remembers the oldest one, see GetOlderMessages
+func (s *SlackService) showMessages(channel Channel, messages []slackMessage) []Message {
+	if len(messages) > 0 {
+		s.setOldest(channel.ID, messages[0].Timestamp)
 	}
+	return s.createMessages(messages, channel.ClientID)
+}
+
+// historyResponse is the response of channels.history, groups.history
+// and im.history
+type historyResponse struct {
+	Messages []slackMessage `json:"messages"`
+	HasMore  bool           `json:"has_more"`
+}
 
-	// Construct the messages
-	var messages []string
-	for _, message := range history.Messages {
-		msg := s.CreateMessage(message, channel.ClientID)
-		messages = append(messages, msg...)
+// getHistory fetches the history of a channel, group or im channel. The
+// history is requested without nlopes/slack to get the blocks of the
+// messages as well.
+func (s *SlackService) getHistory(channel Channel, historyParams slack.HistoryParameters) (*historyResponse, error) {
+	var method string
+	switch channel.SlackChannel.(type) {
+	case slack.Channel:
+		method = "channels.history"
+	case slack.Group:
+		method = "groups.history"
+	case slack.IM:
+		method = "im.history"
+	default:
+		return nil, fmt.Errorf("unknown channel %s", channel.ID)
 	}
 
-	// Reverse the order of the messages, we want the newest in
-	// the last place
-	var messagesReversed []string
-	for i := len(messages) - 1; i >= 0; i-- {
-		messagesReversed = append(messagesReversed, messages[i])
+	// https://api.slack.com/methods/channels.history
+	values := url.Values{
+		"channel": {channel.ID},
+		"count":   {strconv.Itoa(historyParams.Count)},
+	}
+	if historyParams.Latest != "" {
+		values.Set("latest", historyParams.Latest)
+	}
+	if historyParams.Oldest != "" {
+		values.Set("oldest", historyParams.Oldest)
+	}
+	if historyParams.Inclusive {
+		values.Set("inclusive", "1")
+	}
+	if historyParams.Unreads {
+		values.Set("unreads", "1")
 	}
 
-	return messagesReversed
+	var response historyResponse
+	if err := s.apiCall(channel.ClientID, method, values, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
 }
 
-// CreateMessage will create a string formatted message that can be rendered
-// in the Chat pane.
-//
-// [23:59] <erroneousboat> Hello world!
-//
-// This returns an array of string because we will try to uncover attachments
-// associated with messages.
-func (s *SlackService) CreateMessage(message slack.Message, clientID string) []string {
-	var msgs []string
+// cacheFailed reports that the message cache couldn't be written, the
+// cache is only an optimization so the service carries on without it
+func (s *SlackService) cacheFailed(clientID string, err error) {
+	s.events <- Event{
+		ClientID: clientID,
+		Data:     &ErrorEvent{Err: fmt.Errorf("not able to write the message cache: %s", err)},
+	}
+}
 
-	name := s.getMessageUserName(message, clientID)
+// needsBlocks returns whether the blocks and the list of files of a
+// message received over RTM have to be fetched, because nlopes/slack drops
+// them. Blocks are mostly used by bots and apps, so only their messages
+// and messages sharing files are fetched again.
+func needsBlocks(message slack.Message) bool {
+	fileShare := message.SubType == "file_share" && message.File == nil
+	return message.BotID != "" || fileShare
+}
 
-	// When there are attachments append them
-	if len(message.Attachments) > 0 {
-		msgs = append(msgs, createMessageFromAttachments(message.Attachments)...)
+// fetchBlocks fetches a message received over RTM again to add its blocks
+// and list of files, see needsBlocks. It runs in its own goroutine so the
+// RTM events aren't held up, the message is updated in the cache and on
+// screen with a MessageChangedEvent.
+func (s *SlackService) fetchBlocks(clientID string, channelID string, message slack.Message) {
+	channel, ok := s.getJoinedChannel(channelID)
+	if !ok {
+		return
 	}
 
-	intTime := parseMessageTimestamp(message)
+	history, err := s.getHistory(channel, slack.HistoryParameters{
+		Latest:    message.Timestamp,
+		Count:     1,
+		Inclusive: true,
+	})
+	if err != nil || len(history.Messages) == 0 ||
+		history.Messages[0].Timestamp != message.Timestamp {
+		return
+	}
 
-	// Format message
-	msg := s.formatMessage(intTime, name, message.Text)
+	msg := slackMessage{
+		Message: message,
+		Blocks:  history.Messages[0].Blocks,
+		Files:   history.Messages[0].Files,
+	}
+	if len(msg.Blocks) == 0 && len(msg.Files) == 0 {
+		return
+	}
+	if err := s.cache.Update(clientID, channelID, msg); err != nil {
+		s.cacheFailed(clientID, err)
+	}
 
-	msgs = append(msgs, msg)
+	s.events <- Event{
+		ClientID: clientID,
+		Data: &MessageChangedEvent{
+			ChannelID: channelID,
+			Message:   s.createMessage(msg, clientID),
+		},
+	}
+}
 
+// createMessages creates the messages of a list of slack messages
+func (s *SlackService) createMessages(messages []slackMessage, clientID string) []Message {
+	var msgs []Message
+	for _, message := range messages {
+		msgs = append(msgs, s.createMessage(message, clientID))
+	}
 	return msgs
 }
 
-// CreateMessageFromMessageEvent creates a message from an event
-func (s *SlackService) CreateMessageFromMessageEvent(message *slack.MessageEvent, clientID string) []string {
+// lastMessages returns the last count messages
+func lastMessages(messages []slackMessage, count int) []slackMessage {
+	if len(messages) > count {
+		return messages[len(messages)-count:]
+	}
+	return messages
+}
+
+// setSynced marks whether the cache of a channel is up to date with slack.
+// Messages received over RTM are only cached for synced channels, otherwise
+// the cache would end up with gaps.
+func (s *SlackService) setSynced(channelID string, synced bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.synced[channelID] = synced
+}
+
+func (s *SlackService) isSynced(channelID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.synced[channelID]
+}
+
+func (s *SlackService) setOldest(channelID string, timestamp string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.oldest[channelID] = timestamp
+}
+
+func (s *SlackService) getOldest(channelID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.oldest[channelID]
+}
 
-	var msgs []string
+// CreateMessage will create a Message from a slack message, uncovering
+// the name of the user that sent it.
+func (s *SlackService) CreateMessage(message slack.Message, clientID string) Message {
+	msg := Message{
+		Timestamp:       message.Timestamp,
+		Time:            time.Unix(parseMessageTimestamp(message), 0),
+		UserID:          message.User,
+		Name:            s.getMessageUserName(message, clientID),
+		Text:            message.Text,
+		SubType:         message.SubType,
+		ThreadTimestamp: message.ThreadTimestamp,
+		ReplyCount:      message.ReplyCount,
+		Edited:          message.Edited != nil,
+	}
 
-	// Append (edited) when an edited message is received
-	if message.SubType == "message_changed" {
-		message = &slack.MessageEvent{Msg: *message.SubMessage}
-		message.Text = fmt.Sprintf("%s (edited)", message.Text)
+	for _, reaction := range message.Reactions {
+		msg.Reactions = append(msg.Reactions, Reaction{
+			Name:  reaction.Name,
+			Count: reaction.Count,
+			Users: reaction.Users,
+		})
 	}
 
-	// Get username from cache
-	name := s.getMessageUserName(slack.Message(*message), clientID)
+	for _, att := range message.Attachments {
+		attachment := Attachment{
+			Color:   att.Color,
+			Pretext: att.Pretext,
+			Title:   att.Title,
+			Text:    att.Text,
+			Footer:  att.Footer,
+		}
+		for _, field := range att.Fields {
+			attachment.Fields = append(attachment.Fields, AttachmentField{
+				Title: field.Title,
+				Value: field.Value,
+				Short: field.Short,
+			})
+		}
+		msg.Attachments = append(msg.Attachments, attachment)
+	}
 
-	// When there are attachments append them
-	if len(message.Attachments) > 0 {
-		msgs = append(msgs, createMessageFromAttachments(message.Attachments)...)
+	if message.File != nil {
+		msg.Files = append(msg.Files, createFile(*message.File))
 	}
 
-	intTime := parseMessageTimestamp(slack.Message(*message))
+	msg.Mentions = s.getMentions(clientID, msg)
 
-	// Format message
-	msg := s.formatMessage(intTime, name, message.Text)
+	return msg
+}
 
-	msgs = append(msgs, msg)
+// createMessage creates a Message of a message as sent by slack, see
+// CreateMessage
+func (s *SlackService) createMessage(message slackMessage, clientID string) Message {
+	msg := s.CreateMessage(message.Message, clientID)
+	if len(message.Blocks) > 0 {
+		msg.Blocks = createBlocks(message.Blocks)
+		msg.Mentions = s.getMentions(clientID, msg)
+	}
 
-	return msgs
+	// Messages with files have either a single file or a list of them
+	if message.File == nil {
+		for _, file := range message.Files {
+			msg.Files = append(msg.Files, createFile(file))
+		}
+	}
+	return msg
+}
+
+// createFile creates a File of a file as sent by slack
+func createFile(file slack.File) File {
+	return File{
+		ID:         file.ID,
+		Name:       file.Name,
+		Title:      file.Title,
+		Mimetype:   file.Mimetype,
+		Filetype:   file.Filetype,
+		PrettyType: file.PrettyType,
+		Size:       file.Size,
+		URLPrivate: file.URLPrivate,
+		Mode:       file.Mode,
+	}
 }
 
 func parseMessageTimestamp(message slack.Message) int64 {
@@ -336,29 +1204,47 @@ func parseMessageTimestamp(message slack.Message) int64 {
 	return intTime
 }
 
+// getCachedUserName returns the name of a user or bot that has been seen
+// before
+func (s *SlackService) getCachedUserName(userID string) (string, bool) {
+	s.channelsMu.RLock()
+	defer s.channelsMu.RUnlock()
+
+	name, ok := s.userCache[userID]
+	return name, ok
+}
+
+// setCachedUserName keeps the name of a user or bot
+func (s *SlackService) setCachedUserName(userID string, name string) {
+	s.channelsMu.Lock()
+	defer s.channelsMu.Unlock()
+
+	s.userCache[userID] = name
+}
+
 func (s *SlackService) getMessageUserName(message slack.Message, clientID string) string {
 	// Get username from cache
-	name, ok := s.userCache[message.User]
+	name, ok := s.getCachedUserName(message.User)
 
 	// Name not in cache
 	if !ok {
 		if message.BotID != "" {
 			// Name not found, perhaps a bot, use Username
-			name, ok = s.userCache[message.BotID]
+			name, ok = s.getCachedUserName(message.BotID)
 			if !ok {
 				// Not found in cache, add it
 				name = message.Username
-				s.userCache[message.BotID] = message.Username
+				s.setCachedUserName(message.BotID, message.Username)
 			}
 		} else {
 			// Not a bot, not in cache, get user info
-			channelUser, err := s.Client[clientID].GetUserInfo(message.User)
+			channelUser, err := s.client[clientID].GetUserInfo(message.User)
 			if err != nil {
 				name = "unknown"
-				s.userCache[message.User] = name
+				s.setCachedUserName(message.User, name)
 			} else {
 				name = channelUser.Name
-				s.userCache[message.User] = channelUser.Name
+				s.setCachedUserName(message.User, channelUser.Name)
 			}
 		}
 	}
@@ -368,51 +1254,44 @@ func (s *SlackService) getMessageUserName(message slack.Message, clientID string
 	return name
 }
 
-func (s *SlackService) formatMessage(intTime int64, name string, message string) string {
-	re := regexp.MustCompile(`<[!@].+\|@?(\w+)>`)
+// getMentions returns the names of the users and channels mentioned in
+// message, keyed by ID
+func (s *SlackService) getMentions(clientID string, message Message) map[string]string {
+	return resolveMentions(message.mrkdwn(), func(kind string, id string) string {
+		return s.getMentionName(clientID, kind, id)
+	})
+}
 
-	msg := fmt.Sprintf(
-		"[%s] <[%s](fg-green)> %s",
-		time.Unix(intTime, 0).Format("15:04"),
-		name,
-		re.ReplaceAllString(message, "[$1](fg-cyan)"),
-	)
-	return msg
+// getMentionName returns the name of a mentioned user or channel, user
+// groups aren't cached so their label is used instead
+func (s *SlackService) getMentionName(clientID string, kind string, id string) string {
+	switch kind {
+	case "@":
+		if name := s.GetUserName(clientID, id); name != "unknown" {
+			return name
+		}
+	case "#":
+		if channel, ok := s.getJoinedChannel(id); ok {
+			return channel.Name
+		}
+		s.channelsMu.RLock()
+		channel, ok := s.unjoinedChannels[id]
+		s.channelsMu.RUnlock()
+		if ok {
+			return channel.Name
+		}
+	}
+	return ""
 }
 
 // GetChannelName returns the channel name
 func (s *SlackService) GetChannelName(channelID string) string {
-	return s.joinedChannels[channelID].Name
+	channel, _ := s.getJoinedChannel(channelID)
+	return channel.Name
 }
 
 // GetChannelTopic returns the channel topic
 func (s *SlackService) GetChannelTopic(channelID string) string {
-	return s.joinedChannels[channelID].Topic
-}
-
-// createMessageFromAttachments will construct a array of string of the Field
-// values of Attachments from a Message.
-func createMessageFromAttachments(atts []slack.Attachment) []string {
-	var msgs []string
-	for _, att := range atts {
-		for i := len(att.Fields) - 1; i >= 0; i-- {
-			msgs = append(msgs,
-				fmt.Sprintf(
-					"%s %s",
-					att.Fields[i].Title,
-					att.Fields[i].Value,
-				),
-			)
-		}
-
-		if att.Text != "" {
-			msgs = append(msgs, att.Text)
-		}
-
-		if att.Title != "" {
-			msgs = append(msgs, att.Title)
-		}
-	}
-
-	return msgs
+	channel, _ := s.getJoinedChannel(channelID)
+	return channel.Topic
 }
@@ -0,0 +1,1183 @@
+// Package slackmock provides a local stand-in for the Slack Web and RTM
+// APIs. It runs an httptest server which speaks enough of the Slack API
+// for slack-term to run against it, and records every request it
+// receives so the real nlopes/slack code paths can be exercised without
+// a network connection.
+//
+//	server := slackmock.New(team)
+//	defer server.Close()
+//
+//	svc, err := service.CreateSlackService(tokens, server.URL(), nil)
+//
+// The API URL of nlopes/slack is a package variable, so a process should
+// run a single service against a single server at a time, see
+// service.CreateSlackService.
+package slackmock
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// Team is the data served by a Server
+type Team struct {
+	ID     string
+	Name   string
+	UserID string
+	Users  []User
+
+	// Conversations contains the channels, groups and im channels
+	Conversations []Conversation
+
+	// History contains the messages of every conversation, keyed by
+	// conversation ID and ordered from oldest to newest
+	History map[string][]Message
+
+	// Emoji contains the custom emoji, keyed by name, the values are
+	// image URLs or "alias:name" like in the emoji.list response
+	Emoji map[string]string
+}
+
+// User is a member of a Team
+type User struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Deleted bool   `json:"deleted"`
+}
+
+// ConversationType is the type of a Conversation, see constants below
+type ConversationType string
+
+const (
+	// Channel is a public channel
+	Channel ConversationType = "channel"
+	// Group is a private channel
+	Group ConversationType = "group"
+	// IM is a direct message channel
+	IM ConversationType = "im"
+)
+
+// Conversation is a channel, group or im channel of a Team
+type Conversation struct {
+	ID       string
+	Type     ConversationType
+	Name     string
+	Topic    string
+	User     string // only for IM
+	IsMember bool
+	Members  []string // user IDs, the current user is added on join
+	Unread   int
+}
+
+// Message is a message in the History of a Team. Thread replies are part
+// of the History as well, they are left out of the channel history unless
+// SubType is "thread_broadcast".
+type Message struct {
+	Type            string `json:"type"`
+	SubType         string `json:"subtype,omitempty"`
+	User            string `json:"user,omitempty"`
+	Text            string `json:"text"`
+	Timestamp       string `json:"ts"`
+	ThreadTimestamp string `json:"thread_ts,omitempty"`
+	ReplyCount      int    `json:"reply_count,omitempty"`
+	BotID           string `json:"bot_id,omitempty"`
+	Username        string `json:"username,omitempty"`
+
+	Reactions []Reaction `json:"reactions,omitempty"`
+	File      *File      `json:"file,omitempty"`
+	Files     []File     `json:"files,omitempty"`
+
+	// Blocks and Attachments are sent as is
+	Blocks      json.RawMessage `json:"blocks,omitempty"`
+	Attachments json.RawMessage `json:"attachments,omitempty"`
+}
+
+// Reaction is an emoji reaction on a Message
+type Reaction struct {
+	Name  string   `json:"name"`
+	Count int      `json:"count"`
+	Users []string `json:"users"`
+}
+
+// File is a file shared in a Message, its contents are served at
+// URLPrivate
+type File struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Title      string `json:"title"`
+	Mimetype   string `json:"mimetype"`
+	Filetype   string `json:"filetype"`
+	PrettyType string `json:"pretty_type"`
+	Size       int    `json:"size"`
+	URLPrivate string `json:"url_private"`
+}
+
+// isThreadReply returns true when the message is a thread reply that
+// isn't broadcast to the channel
+func (m Message) isThreadReply() bool {
+	return m.ThreadTimestamp != "" &&
+		m.ThreadTimestamp != m.Timestamp &&
+		m.SubType != "thread_broadcast"
+}
+
+// Request is a request received by the Server
+type Request struct {
+	// Method is the name of the API method, e.g. chat.postMessage, or
+	// "rtm" for messages received over the websocket
+	Method string
+	Values url.Values
+}
+
+// Server is a Slack API stand-in, create it with New
+type Server struct {
+	mu       sync.Mutex
+	server   *httptest.Server
+	team     Team
+	requests []Request
+	conns    map[*websocket.Conn]*rtmConn
+	pending  [][]byte
+	sequence int
+	files    map[string][]byte // contents of the uploaded files by ID
+}
+
+// rtmConn is a client connected to the RTM feed, events are queued in out
+// until they are written to the websocket
+type rtmConn struct {
+	out    chan []byte
+	closed chan struct{} // closed when the connection isn't served anymore
+}
+
+// New creates and starts a Server serving team
+func New(team Team) *Server {
+	s := &Server{
+		team:  team,
+		conns: make(map[*websocket.Conn]*rtmConn),
+		files: make(map[string][]byte),
+	}
+	if s.team.History == nil {
+		s.team.History = make(map[string][]Message)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/", s.handleAPI)
+	mux.Handle("/rtm", websocket.Handler(s.handleRTM))
+	mux.HandleFunc("/files/", s.handleFile)
+	s.server = httptest.NewServer(mux)
+
+	return s
+}
+
+// URL returns the API base URL of the server, which can be passed to
+// service.CreateSlackService
+func (s *Server) URL() string {
+	return s.server.URL + "/api/"
+}
+
+// Close shuts down the server
+func (s *Server) Close() {
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.server.Close()
+}
+
+// Requests returns all requests received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requests := make([]Request, len(s.requests))
+	copy(requests, s.requests)
+	return requests
+}
+
+// RequestsFor returns the requests received so far for an API method
+func (s *Server) RequestsFor(method string) []Request {
+	var requests []Request
+	for _, request := range s.Requests() {
+		if request.Method == method {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+// FileContent returns the contents of the uploaded file with id
+func (s *Server) FileContent(id string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, ok := s.files[id]
+	return content, ok
+}
+
+// History returns the messages of a conversation, ordered from oldest
+// to newest
+func (s *Server) History(channelID string) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := make([]Message, len(s.team.History[channelID]))
+	copy(history, s.team.History[channelID])
+	for i := range history {
+		history[i].Reactions = append([]Reaction(nil), history[i].Reactions...)
+	}
+	return history
+}
+
+// SendEvent sends an event to all clients connected to the RTM feed.
+// When no client is connected the event will be sent to the first one
+// that connects.
+func (s *Server) SendEvent(event interface{}) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if len(s.conns) == 0 {
+		s.pending = append(s.pending, data)
+		s.mu.Unlock()
+		return nil
+	}
+
+	conns := make([]*rtmConn, 0, len(s.conns))
+	for _, c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	// Sending blocks while the queue of a connection is full, unless the
+	// connection has gone in the meantime
+	for _, c := range conns {
+		select {
+		case c.out <- data:
+		case <-c.closed:
+		}
+	}
+	return nil
+}
+
+// SendMessage adds a message to the history of a conversation and sends
+// it to the RTM feed, as if it was sent by userID.
+func (s *Server) SendMessage(channelID string, userID string, text string) error {
+	msg := s.addMessage(channelID, userID, text)
+	return s.SendEvent(messageEvent(channelID, msg))
+}
+
+// SendBotMessage adds a message of the bot botID with blocks to the
+// history of a conversation and sends it to the RTM feed
+func (s *Server) SendBotMessage(channelID string, botID string, text string, blocks json.RawMessage) error {
+	s.mu.Lock()
+	s.sequence++
+	msg := Message{
+		Type:      "message",
+		SubType:   "bot_message",
+		BotID:     botID,
+		Username:  botID,
+		Text:      text,
+		Timestamp: fmt.Sprintf("%d.%06d", time.Now().Unix(), s.sequence),
+		Blocks:    blocks,
+	}
+	s.team.History[channelID] = append(s.team.History[channelID], msg)
+	s.mu.Unlock()
+
+	return s.SendEvent(messageEvent(channelID, msg))
+}
+
+// SendReply adds a reply to the thread of the message with threadTimestamp
+// and sends it to the RTM feed, followed by a message_replied event for
+// the thread parent.
+func (s *Server) SendReply(channelID string, threadTimestamp string, userID string, text string, broadcast bool) error {
+	msg := s.addReply(channelID, threadTimestamp, userID, text, broadcast)
+	if err := s.SendEvent(messageEvent(channelID, msg)); err != nil {
+		return err
+	}
+	return s.sendReplied(channelID, threadTimestamp)
+}
+
+func (s *Server) addReply(channelID string, threadTimestamp string, userID string, text string, broadcast bool) Message {
+	s.addMessage(channelID, userID, text)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := s.team.History[channelID]
+	last := &history[len(history)-1]
+	last.ThreadTimestamp = threadTimestamp
+	if broadcast {
+		last.SubType = "thread_broadcast"
+	}
+	return *last
+}
+
+// sendReplied sends the message_replied event of a thread parent
+func (s *Server) sendReplied(channelID string, threadTimestamp string) error {
+	parent, ok := s.message(channelID, threadTimestamp)
+	if !ok {
+		return fmt.Errorf("message %s not found in %s", threadTimestamp, channelID)
+	}
+
+	s.mu.Lock()
+	s.sequence++
+	ts := fmt.Sprintf("%d.%06d", time.Now().Unix(), s.sequence)
+	s.mu.Unlock()
+
+	return s.SendEvent(map[string]interface{}{
+		"type":    "message",
+		"subtype": "message_replied",
+		"channel": channelID,
+		"hidden":  true,
+		"ts":      ts,
+		"message": parent,
+	})
+}
+
+// message returns a message of a conversation with its reply count
+func (s *Server) message(channelID string, timestamp string) (Message, bool) {
+	history := s.History(channelID)
+	for _, msg := range history {
+		if msg.Timestamp == timestamp {
+			msg.ReplyCount = replyCount(history, timestamp)
+			return msg, true
+		}
+	}
+	return Message{}, false
+}
+
+// replyCount returns the number of replies in the thread of the message
+// with timestamp
+func replyCount(history []Message, timestamp string) int {
+	count := 0
+	for _, msg := range history {
+		if msg.ThreadTimestamp == timestamp && msg.Timestamp != timestamp {
+			count++
+		}
+	}
+	return count
+}
+
+// AddReaction adds the reaction name of userID to a message and sends a
+// reaction_added event to the RTM feed
+func (s *Server) AddReaction(channelID string, timestamp string, userID string, name string) error {
+	return s.react(channelID, timestamp, userID, name, true)
+}
+
+// RemoveReaction removes the reaction name of userID from a message and
+// sends a reaction_removed event to the RTM feed
+func (s *Server) RemoveReaction(channelID string, timestamp string, userID string, name string) error {
+	return s.react(channelID, timestamp, userID, name, false)
+}
+
+func (s *Server) react(channelID string, timestamp string, userID string, name string, added bool) error {
+	s.mu.Lock()
+	var msg *Message
+	history := s.team.History[channelID]
+	for i := range history {
+		if history[i].Timestamp == timestamp {
+			msg = &history[i]
+		}
+	}
+	if msg == nil {
+		s.mu.Unlock()
+		return fmt.Errorf("message_not_found")
+	}
+
+	var err error
+	if added {
+		err = addReaction(msg, userID, name)
+	} else {
+		err = removeReaction(msg, userID, name)
+	}
+	itemUser := msg.User
+	s.sequence++
+	ts := fmt.Sprintf("%d.%06d", time.Now().Unix(), s.sequence)
+	s.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	eventType := "reaction_added"
+	if !added {
+		eventType = "reaction_removed"
+	}
+	return s.SendEvent(map[string]interface{}{
+		"type":      eventType,
+		"user":      userID,
+		"item_user": itemUser,
+		"reaction":  name,
+		"event_ts":  ts,
+		"item": map[string]interface{}{
+			"type":    "message",
+			"channel": channelID,
+			"ts":      timestamp,
+		},
+	})
+}
+
+func addReaction(msg *Message, userID string, name string) error {
+	for i := range msg.Reactions {
+		if msg.Reactions[i].Name != name {
+			continue
+		}
+		for _, user := range msg.Reactions[i].Users {
+			if user == userID {
+				return fmt.Errorf("already_reacted")
+			}
+		}
+		msg.Reactions[i].Users = append(msg.Reactions[i].Users, userID)
+		msg.Reactions[i].Count++
+		return nil
+	}
+
+	msg.Reactions = append(msg.Reactions, Reaction{Name: name, Count: 1, Users: []string{userID}})
+	return nil
+}
+
+func removeReaction(msg *Message, userID string, name string) error {
+	for i := range msg.Reactions {
+		if msg.Reactions[i].Name != name {
+			continue
+		}
+		for j, user := range msg.Reactions[i].Users {
+			if user != userID {
+				continue
+			}
+			reaction := &msg.Reactions[i]
+			reaction.Users = append(reaction.Users[:j:j], reaction.Users[j+1:]...)
+			reaction.Count--
+			if reaction.Count == 0 {
+				msg.Reactions = append(msg.Reactions[:i:i], msg.Reactions[i+1:]...)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("no_reaction")
+}
+
+// EditMessage changes the text of a message in the history of a
+// conversation and sends a message_changed event to the RTM feed
+func (s *Server) EditMessage(channelID string, timestamp string, text string) error {
+	s.mu.Lock()
+	var edited *Message
+	history := s.team.History[channelID]
+	for i := range history {
+		if history[i].Timestamp == timestamp {
+			history[i].Text = text
+			edited = &history[i]
+		}
+	}
+	if edited == nil {
+		s.mu.Unlock()
+		return fmt.Errorf("message %s not found in %s", timestamp, channelID)
+	}
+	msg := *edited
+	msg.ReplyCount = replyCount(history, msg.Timestamp)
+	s.sequence++
+	ts := fmt.Sprintf("%d.%06d", time.Now().Unix(), s.sequence)
+	s.mu.Unlock()
+
+	return s.SendEvent(map[string]interface{}{
+		"type":    "message",
+		"subtype": "message_changed",
+		"channel": channelID,
+		"hidden":  true,
+		"ts":      ts,
+		"message": map[string]interface{}{
+			"type":        "message",
+			"user":        msg.User,
+			"text":        msg.Text,
+			"ts":          msg.Timestamp,
+			"thread_ts":   msg.ThreadTimestamp,
+			"reply_count": msg.ReplyCount,
+			"edited":      map[string]interface{}{"user": msg.User, "ts": msg.Timestamp},
+		},
+	})
+}
+
+// DeleteMessage removes a message from the history of a conversation and
+// sends a message_deleted event to the RTM feed
+func (s *Server) DeleteMessage(channelID string, timestamp string) error {
+	s.mu.Lock()
+	found := false
+	history := s.team.History[channelID]
+	for i := range history {
+		if history[i].Timestamp == timestamp {
+			s.team.History[channelID] = append(history[:i:i], history[i+1:]...)
+			found = true
+			break
+		}
+	}
+	if !found {
+		s.mu.Unlock()
+		return fmt.Errorf("message %s not found in %s", timestamp, channelID)
+	}
+	s.sequence++
+	ts := fmt.Sprintf("%d.%06d", time.Now().Unix(), s.sequence)
+	s.mu.Unlock()
+
+	return s.SendEvent(map[string]interface{}{
+		"type":       "message",
+		"subtype":    "message_deleted",
+		"channel":    channelID,
+		"hidden":     true,
+		"ts":         ts,
+		"deleted_ts": timestamp,
+	})
+}
+
+func (s *Server) addMessage(channelID string, userID string, text string) Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sequence++
+	msg := Message{
+		Type:      "message",
+		User:      userID,
+		Text:      text,
+		Timestamp: fmt.Sprintf("%d.%06d", time.Now().Unix(), s.sequence),
+	}
+	s.team.History[channelID] = append(s.team.History[channelID], msg)
+
+	return msg
+}
+
+func messageEvent(channelID string, msg Message) map[string]interface{} {
+	event := map[string]interface{}{
+		"type":    "message",
+		"channel": channelID,
+		"user":    msg.User,
+		"text":    msg.Text,
+		"ts":      msg.Timestamp,
+	}
+	if msg.SubType != "" {
+		event["subtype"] = msg.SubType
+	}
+	if msg.ThreadTimestamp != "" {
+		event["thread_ts"] = msg.ThreadTimestamp
+	}
+	if msg.BotID != "" {
+		event["bot_id"] = msg.BotID
+		event["username"] = msg.Username
+	}
+	if msg.Blocks != nil {
+		event["blocks"] = msg.Blocks
+	}
+	if msg.File != nil {
+		event["file"] = msg.File
+	}
+	return event
+}
+
+// handleAPI handles the Web API methods
+func (s *Server) handleAPI(w http.ResponseWriter, r *http.Request) {
+	// files.upload sends the file as multipart form
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		err = r.ParseMultipartForm(32 << 20)
+	} else {
+		err = r.ParseForm()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	method := strings.TrimPrefix(r.URL.Path, "/api/")
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: method, Values: r.Form})
+	s.mu.Unlock()
+
+	var response map[string]interface{}
+	switch method {
+	case "auth.test":
+		response = map[string]interface{}{
+			"user_id": s.team.UserID,
+			"user":    s.userName(s.team.UserID),
+			"team_id": s.team.ID,
+			"team":    s.team.Name,
+		}
+	case "users.list":
+		response = map[string]interface{}{"members": s.team.Users}
+	case "emoji.list":
+		response = map[string]interface{}{"emoji": s.team.Emoji}
+	case "users.info":
+		user, ok := s.user(r.Form.Get("user"))
+		if !ok {
+			writeError(w, "user_not_found")
+			return
+		}
+		response = map[string]interface{}{"user": user}
+	case "channels.list":
+		response = map[string]interface{}{"channels": s.conversations(Channel)}
+	case "groups.list":
+		response = map[string]interface{}{"groups": s.conversations(Group)}
+	case "im.list":
+		response = map[string]interface{}{"ims": s.conversations(IM)}
+	case "channels.history", "groups.history", "im.history":
+		response = s.history(r.Form)
+	case "chat.postMessage":
+		channelID := r.Form.Get("channel")
+		threadTimestamp := r.Form.Get("thread_ts")
+		if threadTimestamp == "" {
+			msg := s.addMessage(channelID, s.team.UserID, r.Form.Get("text"))
+			s.SendEvent(messageEvent(channelID, msg))
+			response = map[string]interface{}{"channel": channelID, "ts": msg.Timestamp}
+			break
+		}
+
+		if _, ok := s.message(channelID, threadTimestamp); !ok {
+			writeError(w, "thread_not_found")
+			return
+		}
+		broadcast := r.Form.Get("reply_broadcast") == "true"
+		msg := s.addReply(channelID, threadTimestamp, s.team.UserID, r.Form.Get("text"), broadcast)
+		s.SendEvent(messageEvent(channelID, msg))
+		s.sendReplied(channelID, threadTimestamp)
+		response = map[string]interface{}{"channel": channelID, "ts": msg.Timestamp}
+	case "chat.update":
+		channelID, timestamp := r.Form.Get("channel"), r.Form.Get("ts")
+		if err := s.EditMessage(channelID, timestamp, r.Form.Get("text")); err != nil {
+			writeError(w, "message_not_found")
+			return
+		}
+		response = map[string]interface{}{"channel": channelID, "ts": timestamp, "text": r.Form.Get("text")}
+	case "chat.delete":
+		channelID, timestamp := r.Form.Get("channel"), r.Form.Get("ts")
+		if err := s.DeleteMessage(channelID, timestamp); err != nil {
+			writeError(w, "message_not_found")
+			return
+		}
+		response = map[string]interface{}{"channel": channelID, "ts": timestamp}
+	case "reactions.add", "reactions.remove":
+		err := s.react(
+			r.Form.Get("channel"), r.Form.Get("timestamp"), s.team.UserID,
+			r.Form.Get("name"), method == "reactions.add")
+		if err != nil {
+			writeError(w, err.Error())
+			return
+		}
+		response = map[string]interface{}{}
+	case "conversations.replies":
+		response = s.replies(r.Form)
+		if response == nil {
+			writeError(w, "thread_not_found")
+			return
+		}
+	case "channels.create", "groups.create":
+		conversationType, key := Channel, "channel"
+		if method == "groups.create" {
+			conversationType, key = Group, "group"
+		}
+		conv, ok := s.create(conversationType, r.Form.Get("name"), []string{s.team.UserID})
+		if !ok {
+			writeError(w, "name_taken")
+			return
+		}
+		response = map[string]interface{}{key: conv}
+	case "im.open", "mpim.open":
+		userIDs := strings.Split(r.Form.Get("users"), ",")
+		if method == "im.open" {
+			userIDs = []string{r.Form.Get("user")}
+		}
+		conv, ok := s.open(userIDs)
+		if !ok {
+			writeError(w, "user_not_found")
+			return
+		}
+		if method == "im.open" {
+			response = map[string]interface{}{"channel": conv}
+		} else {
+			response = map[string]interface{}{"group": conv}
+		}
+	case "channels.setTopic", "groups.setTopic":
+		if !s.setTopic(r.Form.Get("channel"), r.Form.Get("topic")) {
+			writeError(w, "channel_not_found")
+			return
+		}
+		response = map[string]interface{}{"topic": r.Form.Get("topic")}
+	case "channels.join":
+		conv, ok := s.join(r.Form.Get("name"))
+		if !ok {
+			writeError(w, "channel_not_found")
+			return
+		}
+		response = map[string]interface{}{"channel": conv}
+	case "channels.leave":
+		if !s.leave(r.Form.Get("channel")) {
+			writeError(w, "channel_not_found")
+			return
+		}
+		response = map[string]interface{}{}
+	case "channels.mark", "groups.mark", "im.mark":
+		response = map[string]interface{}{}
+	case "rtm.start", "rtm.connect":
+		response = map[string]interface{}{
+			"url":      "ws" + strings.TrimPrefix(s.server.URL, "http") + "/rtm",
+			"self":     map[string]interface{}{"id": s.team.UserID, "name": s.userName(s.team.UserID)},
+			"team":     map[string]interface{}{"id": s.team.ID, "name": s.team.Name},
+			"users":    s.team.Users,
+			"channels": s.conversations(Channel),
+			"groups":   s.conversations(Group),
+			"ims":      s.conversations(IM),
+		}
+	case "files.upload":
+		content := []byte(r.Form.Get("content"))
+		if r.MultipartForm != nil && len(r.MultipartForm.File["file"]) > 0 {
+			file, err := r.MultipartForm.File["file"][0].Open()
+			if err != nil {
+				writeError(w, "no_file_data")
+				return
+			}
+			content, err = ioutil.ReadAll(file)
+			file.Close()
+			if err != nil {
+				writeError(w, "no_file_data")
+				return
+			}
+		}
+
+		channelID := strings.Split(r.Form.Get("channels"), ",")[0]
+		msg := s.addFile(channelID, r.Form.Get("filename"), r.Form.Get("title"), r.Form.Get("initial_comment"), content)
+		if channelID != "" {
+			s.SendEvent(messageEvent(channelID, msg))
+		}
+		response = map[string]interface{}{"file": msg.File}
+	default:
+		writeError(w, "unknown_method")
+		return
+	}
+
+	response["ok"] = true
+	writeJSON(w, response)
+}
+
+// addFile stores an uploaded file and adds the message sharing it to the
+// history of channelID
+func (s *Server) addFile(channelID string, name string, title string, comment string, content []byte) Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sequence++
+	id := fmt.Sprintf("F%d", s.sequence)
+	s.files[id] = content
+
+	filetype := strings.TrimPrefix(path.Ext(name), ".")
+	if filetype == "" {
+		filetype = "text"
+	}
+	if title == "" {
+		title = name
+	}
+
+	msg := Message{
+		Type:      "message",
+		SubType:   "file_share",
+		User:      s.team.UserID,
+		Text:      comment,
+		Timestamp: fmt.Sprintf("%d.%06d", time.Now().Unix(), s.sequence),
+		File: &File{
+			ID:         id,
+			Name:       name,
+			Title:      title,
+			Mimetype:   http.DetectContentType(content),
+			Filetype:   filetype,
+			PrettyType: strings.ToUpper(filetype),
+			Size:       len(content),
+			URLPrivate: fmt.Sprintf("%s/files/%s/%s", s.server.URL, id, url.PathEscape(name)),
+		},
+	}
+	if channelID != "" {
+		s.team.History[channelID] = append(s.team.History[channelID], msg)
+	}
+
+	return msg
+}
+
+// handleFile serves the contents of an uploaded file at
+// /files/<id>/<name>, like slack it requires a token in the Authorization
+// header
+func (s *Server) handleFile(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		http.Error(w, "not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/files/"), "/", 2)[0]
+
+	content, ok := s.FileContent(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write(content)
+}
+
+// history returns a page of the history of a conversation, newest
+// messages first, honouring the latest, oldest and count parameters.
+func (s *Server) history(values url.Values) map[string]interface{} {
+	history := s.History(values.Get("channel"))
+
+	count, err := strconv.Atoi(values.Get("count"))
+	if err != nil || count <= 0 {
+		count = 100
+	}
+	latest := parseTimestamp(values.Get("latest"), 1<<62)
+	oldest := parseTimestamp(values.Get("oldest"), 0)
+	inclusive := values.Get("inclusive") == "1"
+
+	messages := []Message{}
+	hasMore := false
+	for i := len(history) - 1; i >= 0; i-- {
+		ts := parseTimestamp(history[i].Timestamp, 0)
+		if ts > latest || ts < oldest || history[i].isThreadReply() {
+			continue
+		}
+		if !inclusive && (ts == latest || ts == oldest) {
+			continue
+		}
+		if len(messages) == count {
+			hasMore = true
+			break
+		}
+		msg := history[i]
+		msg.ReplyCount = replyCount(history, msg.Timestamp)
+		messages = append(messages, msg)
+	}
+
+	return map[string]interface{}{
+		"messages": messages,
+		"has_more": hasMore,
+	}
+}
+
+// replies returns the parent message of a thread followed by its replies,
+// or nil when there is no such thread. All replies are returned in a
+// single page.
+func (s *Server) replies(values url.Values) map[string]interface{} {
+	threadTimestamp := values.Get("ts")
+	parent, ok := s.message(values.Get("channel"), threadTimestamp)
+	if !ok {
+		return nil
+	}
+
+	messages := []Message{parent}
+	for _, msg := range s.History(values.Get("channel")) {
+		if msg.ThreadTimestamp == threadTimestamp && msg.Timestamp != threadTimestamp {
+			messages = append(messages, msg)
+		}
+	}
+
+	return map[string]interface{}{
+		"messages": messages,
+		"has_more": false,
+	}
+}
+
+func parseTimestamp(ts string, def float64) float64 {
+	f, err := strconv.ParseFloat(ts, 64)
+	if err != nil || f == 0 {
+		return def
+	}
+	return f
+}
+
+// conversations returns the conversations of a type in the JSON shape of
+// the Slack API
+func (s *Server) conversations(conversationType ConversationType) []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := []map[string]interface{}{}
+	for _, conv := range s.team.Conversations {
+		if conv.Type != conversationType {
+			continue
+		}
+
+		c := map[string]interface{}{
+			"id":                   conv.ID,
+			"is_open":              true,
+			"unread_count":         conv.Unread,
+			"unread_count_display": conv.Unread,
+		}
+		switch conv.Type {
+		case IM:
+			c["is_im"] = true
+			c["user"] = conv.User
+		default:
+			c["name"] = conv.Name
+			c["topic"] = map[string]interface{}{"value": conv.Topic}
+			c["is_channel"] = conv.Type == Channel
+			c["is_group"] = conv.Type == Group
+			c["is_member"] = conv.IsMember || conv.Type == Group
+			c["members"] = append([]string{}, conv.Members...)
+		}
+		result = append(result, c)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i]["id"].(string) < result[j]["id"].(string)
+	})
+
+	return result
+}
+
+// join makes the current user a member of the public channel called
+// name and returns the channel like channels.list does
+func (s *Server) join(name string) (map[string]interface{}, bool) {
+	s.mu.Lock()
+	var id string
+	for i, conv := range s.team.Conversations {
+		if conv.Type != Channel || conv.Name != name {
+			continue
+		}
+		if !conv.IsMember {
+			s.team.Conversations[i].IsMember = true
+			s.team.Conversations[i].Members = append(conv.Members, s.team.UserID)
+		}
+		id = conv.ID
+	}
+	s.mu.Unlock()
+
+	return s.conversation(Channel, id)
+}
+
+// create adds a channel or group called name with members and returns it
+// like channels.list does, ok is false when the name is taken
+func (s *Server) create(conversationType ConversationType, name string, members []string) (map[string]interface{}, bool) {
+	s.mu.Lock()
+	for _, conv := range s.team.Conversations {
+		if conv.Type != IM && conv.Name == name {
+			s.mu.Unlock()
+			return nil, false
+		}
+	}
+
+	id := s.nextConversationID(strings.ToUpper(string(conversationType[0])))
+	s.team.Conversations = append(s.team.Conversations, Conversation{
+		ID:       id,
+		Type:     conversationType,
+		Name:     name,
+		IsMember: true,
+		Members:  members,
+	})
+	s.mu.Unlock()
+
+	return s.conversation(conversationType, id)
+}
+
+// open returns the im channel with a single user, or the multiparty im
+// channel, which is a group, with several users. The channel is added
+// when it doesn't exist yet, ok is false when a user is unknown.
+func (s *Server) open(userIDs []string) (map[string]interface{}, bool) {
+	names := []string{}
+	for _, userID := range userIDs {
+		if _, ok := s.user(userID); !ok {
+			return nil, false
+		}
+		names = append(names, s.userName(userID))
+	}
+
+	if len(userIDs) > 1 {
+		names = append(names, s.userName(s.team.UserID))
+		name := fmt.Sprintf("mpdm-%s-1", strings.Join(names, "--"))
+		if conv, ok := s.create(Group, name, append(userIDs, s.team.UserID)); ok {
+			return conv, true
+		}
+
+		for _, conv := range s.conversations(Group) {
+			if conv["name"] == name {
+				return conv, true
+			}
+		}
+		return nil, false
+	}
+
+	s.mu.Lock()
+	var id string
+	for _, conv := range s.team.Conversations {
+		if conv.Type == IM && conv.User == userIDs[0] {
+			id = conv.ID
+		}
+	}
+	if id == "" {
+		id = s.nextConversationID("D")
+		s.team.Conversations = append(s.team.Conversations, Conversation{
+			ID:   id,
+			Type: IM,
+			User: userIDs[0],
+		})
+	}
+	s.mu.Unlock()
+
+	return s.conversation(IM, id)
+}
+
+// setTopic sets the topic of the channel or group with channelID
+func (s *Server) setTopic(channelID string, topic string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, conv := range s.team.Conversations {
+		if conv.Type != IM && conv.ID == channelID {
+			s.team.Conversations[i].Topic = topic
+			return true
+		}
+	}
+	return false
+}
+
+// nextConversationID generates an ID starting with prefix that isn't used
+// by any conversation. The caller must hold s.mu.
+func (s *Server) nextConversationID(prefix string) string {
+	for {
+		s.sequence++
+		id := fmt.Sprintf("%s%d", prefix, s.sequence)
+
+		used := false
+		for _, conv := range s.team.Conversations {
+			used = used || conv.ID == id
+		}
+		if !used {
+			return id
+		}
+	}
+}
+
+// conversation returns the conversation with id like the list methods do
+func (s *Server) conversation(conversationType ConversationType, id string) (map[string]interface{}, bool) {
+	for _, conv := range s.conversations(conversationType) {
+		if conv["id"] == id {
+			return conv, true
+		}
+	}
+	return nil, false
+}
+
+// leave removes the current user from the members of the public channel
+// with channelID
+func (s *Server) leave(channelID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, conv := range s.team.Conversations {
+		if conv.Type != Channel || conv.ID != channelID {
+			continue
+		}
+
+		var members []string
+		for _, member := range conv.Members {
+			if member != s.team.UserID {
+				members = append(members, member)
+			}
+		}
+		s.team.Conversations[i].IsMember = false
+		s.team.Conversations[i].Members = members
+		return true
+	}
+	return false
+}
+
+func (s *Server) user(userID string) (User, bool) {
+	for _, user := range s.team.Users {
+		if user.ID == userID {
+			return user, true
+		}
+	}
+	return User{}, false
+}
+
+func (s *Server) userName(userID string) string {
+	user, _ := s.user(userID)
+	return user.Name
+}
+
+// handleRTM serves the RTM websocket feed, it greets the client with a
+// hello event, answers its pings and forwards the events sent with
+// SendEvent.
+func (s *Server) handleRTM(conn *websocket.Conn) {
+	s.mu.Lock()
+	c := &rtmConn{
+		out:    make(chan []byte, len(s.pending)+50),
+		closed: make(chan struct{}),
+	}
+	s.conns[conn] = c
+	c.out <- []byte(`{"type":"hello"}`)
+	for _, data := range s.pending {
+		c.out <- data
+	}
+	s.pending = nil
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		close(c.closed)
+		conn.Close()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			var event map[string]interface{}
+			if err := websocket.JSON.Receive(conn, &event); err != nil {
+				return
+			}
+
+			values := url.Values{}
+			for k, v := range event {
+				values.Set(k, fmt.Sprint(v))
+			}
+			s.mu.Lock()
+			s.requests = append(s.requests, Request{Method: "rtm", Values: values})
+			s.mu.Unlock()
+
+			if event["type"] == "ping" {
+				select {
+				case c.out <- []byte(fmt.Sprintf(`{"type":"pong","reply_to":%v}`, event["id"])):
+				case <-c.closed:
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		select {
+		case data := <-c.out:
+			if err := websocket.Message.Send(conn, string(data)); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, slackErr string) {
+	writeJSON(w, map[string]interface{}{"ok": false, "error": slackErr})
+}
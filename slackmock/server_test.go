@@ -0,0 +1,214 @@
+package slackmock_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jvalduvieco/slack-term/service"
+	"github.com/jvalduvieco/slack-term/slackmock"
+)
+
+// The tests share a single server and service, because CreateSlackService
+// sets the API URL of nlopes/slack for the whole process and the RTM of a
+// service keeps reconnecting to it. Every test uses its own channel.
+var (
+	server *slackmock.Server
+	svc    *service.SlackService
+)
+
+func TestMain(m *testing.M) {
+	server = slackmock.New(slackmock.Team{
+		ID:     "T1",
+		Name:   "team",
+		UserID: "U1",
+		Users: []slackmock.User{
+			{ID: "U1", Name: "me"},
+			{ID: "U2", Name: "bob"},
+		},
+		Conversations: []slackmock.Conversation{
+			{ID: "C1", Type: slackmock.Channel, Name: "history", IsMember: true, Members: []string{"U1", "U2"}},
+			{ID: "C2", Type: slackmock.Channel, Name: "post", IsMember: true, Members: []string{"U1", "U2"}},
+			{ID: "C3", Type: slackmock.Channel, Name: "rtm", IsMember: true, Members: []string{"U1", "U2"}},
+			{ID: "C4", Type: slackmock.Channel, Name: "bot", IsMember: true, Members: []string{"U1", "U2"}},
+		},
+		Emoji: map[string]string{"party": "alias:tada"},
+		History: map[string][]slackmock.Message{
+			"C1": {
+				{Type: "message", User: "U2", Text: "first", Timestamp: "1500000000.000001"},
+				{Type: "message", User: "U1", Text: "second", Timestamp: "1500000000.000002"},
+			},
+		},
+	})
+
+	var err error
+	svc, err = service.CreateSlackService(map[string]string{"T1": "token"}, server.URL(), nil)
+	if err != nil {
+		server.Close()
+		panic(err)
+	}
+	svc.GetChannelList()
+
+	code := m.Run()
+	server.Close()
+	os.Exit(code)
+}
+
+func TestHistory(t *testing.T) {
+	messages := svc.GetMessages("C1", 10)
+	if len(messages) != 2 {
+		t.Fatalf("got %d messages, want 2", len(messages))
+	}
+	if messages[0].Text != "first" || messages[0].Name != "bob" {
+		t.Errorf("got first message %q by %q, want \"first\" by \"bob\"", messages[0].Text, messages[0].Name)
+	}
+	if messages[1].Text != "second" || messages[1].Name != "me" {
+		t.Errorf("got second message %q by %q, want \"second\" by \"me\"", messages[1].Text, messages[1].Name)
+	}
+}
+
+func TestPostMessage(t *testing.T) {
+	before := len(postedTo("C2"))
+	svc.SendMessage("C2", "hello")
+
+	requests := postedTo("C2")
+	if len(requests) != before+1 {
+		t.Fatalf("got %d new chat.postMessage requests for C2, want 1", len(requests)-before)
+	}
+	if text := requests[len(requests)-1].Values.Get("text"); text != "hello" {
+		t.Errorf("got text %q, want \"hello\"", text)
+	}
+
+	history := server.History("C2")
+	if last := history[len(history)-1]; last.Text != "hello" || last.User != "U1" {
+		t.Errorf("got last message %q by %q, want \"hello\" by \"U1\"", last.Text, last.User)
+	}
+}
+
+// postedTo returns the chat.postMessage requests for channelID
+func postedTo(channelID string) []slackmock.Request {
+	var requests []slackmock.Request
+	for _, request := range server.RequestsFor("chat.postMessage") {
+		if request.Values.Get("channel") == channelID {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+func TestRTMMessage(t *testing.T) {
+	// The message waits for the RTM connection when it isn't made yet
+	if err := server.SendMessage("C3", "U2", "ping"); err != nil {
+		t.Fatal(err)
+	}
+
+	ev := waitFor(t, func(event service.Event) bool {
+		ev, ok := event.Data.(*service.MessageEvent)
+		return ok && ev.ChannelID == "C3"
+	}).(*service.MessageEvent)
+	if ev.UserID != "U2" || ev.Message.Text != "ping" {
+		t.Fatalf("got message %q from %q, want \"ping\" from \"U2\"", ev.Message.Text, ev.UserID)
+	}
+}
+
+func TestRTMBotMessage(t *testing.T) {
+	blocks := json.RawMessage(`[{"type": "section", "text": {"type": "mrkdwn", "text": "*build* passed"}}]`)
+	if err := server.SendBotMessage("C4", "B1", "build passed", blocks); err != nil {
+		t.Fatal(err)
+	}
+
+	// The message is shown right away, its blocks follow once they are
+	// fetched
+	waitFor(t, func(event service.Event) bool {
+		ev, ok := event.Data.(*service.MessageEvent)
+		return ok && ev.ChannelID == "C4"
+	})
+	changed := waitFor(t, func(event service.Event) bool {
+		ev, ok := event.Data.(*service.MessageChangedEvent)
+		return ok && ev.ChannelID == "C4"
+	}).(*service.MessageChangedEvent)
+	if len(changed.Message.Blocks) != 1 {
+		t.Errorf("got %d blocks, want 1", len(changed.Message.Blocks))
+	}
+}
+
+// waitFor returns the data of the first incoming event that matches, other
+// events are skipped
+func waitFor(t *testing.T, match func(service.Event) bool) interface{} {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-svc.IncomingEvents():
+			if match(event) {
+				return event.Data
+			}
+		case <-timeout:
+			t.Fatal("no matching event arrived over the RTM feed")
+		}
+	}
+}
+
+func TestCustomEmoji(t *testing.T) {
+	// The emoji are fetched in the background, the CustomEmojiEvent
+	// might have been passed over by waitFor already
+	deadline := time.Now().Add(5 * time.Second)
+	emoji := svc.GetCustomEmoji("T1")
+	for emoji == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		emoji = svc.GetCustomEmoji("T1")
+	}
+
+	if code, ok := emoji["party"]; !ok || code == "" {
+		t.Errorf("got %q for :party:, want the code of :tada:", code)
+	}
+}
+
+func TestDownloadFile(t *testing.T) {
+	if err := svc.UploadFile("C2", "note.txt", strings.NewReader("hi"), ""); err != nil {
+		t.Fatal(err)
+	}
+	history := server.History("C2")
+	file := history[len(history)-1].File
+
+	var buf bytes.Buffer
+	if err := svc.DownloadFile("C2", service.File{Name: file.Name, URLPrivate: file.URLPrivate}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "hi" {
+		t.Errorf("got content %q, want \"hi\"", buf.String())
+	}
+}
+
+func TestDownloadFileElsewhere(t *testing.T) {
+	var authorization string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.Write([]byte("hi"))
+	}))
+	defer other.Close()
+
+	// The token is only sent to slack
+	file := service.File{Name: "note.txt", URLPrivate: other.URL + "/note.txt"}
+	if err := svc.DownloadFile("C2", file, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if authorization != "" {
+		t.Errorf("got Authorization %q sent to another host, want none", authorization)
+	}
+
+	// External files aren't downloaded at all
+	file.Mode = "external"
+	authorization = "not requested"
+	if err := svc.DownloadFile("C2", file, ioutil.Discard); err == nil {
+		t.Error("got no error downloading an external file")
+	}
+	if authorization != "not requested" {
+		t.Error("an external file has been requested")
+	}
+}
@@ -1,6 +1,9 @@
 package views
 
 import (
+	"fmt"
+	"sort"
+
 	"github.com/gizak/termui"
 
 	"github.com/jvalduvieco/slack-term/components"
@@ -14,23 +17,35 @@ type View struct {
 	Chat     *components.Chat
 	Channels *components.Channels
 	Mode     *components.Mode
+	Thread   *components.Thread
+	Switcher *components.Switcher
+	Browser  *components.Switcher
 	Body     *termui.Grid
+
+	sidebarWidth int
+	mainWidth    int
+	inputHeight  int // height of the Input when the body was laid out
 }
 
 // CreateUIComponents builds all the widgets needed for the app
-func CreateUIComponents(config *config.Config, svc *service.SlackService) *View {
+func CreateUIComponents(config *config.Config, svc service.Backend) *View {
 
-	inputComponent := components.CreateInput()
+	inputComponent := components.CreateInput(config.InputLines)
 
 	channelsComponent := components.CreateChannels(inputComponent.GetHeight())
 	channels := svc.GetChannelList()
 	channelsComponent.SetChannels(channels)
+	channelsComponent.MarkAsVisited(channelsComponent.GetSelectedChannelID())
 
 	chatComponent := components.CreateChat(
 		inputComponent.GetHeight(),
 		svc.GetChannelName(channelsComponent.GetSelectedChannelID()),
 		svc.GetChannelTopic(channelsComponent.GetSelectedChannelID()),
 	)
+	chatComponent.SetCustomEmoji(
+		svc.GetCustomEmoji(channelsComponent.GetSelectedClientID()))
+	chatComponent.SetCurrentUserID(
+		svc.GetCurrentUserID(channelsComponent.GetSelectedClientID()))
 
 	chatComponent.AddMessages(
 		svc.GetMessages(
@@ -38,37 +53,213 @@ func CreateUIComponents(config *config.Config, svc *service.SlackService) *View
 			chatComponent.GetMaxNumberOfMessagesVisible()))
 	modeComponent := components.CreateMode()
 
+	threadComponent := components.CreateThread(inputComponent.GetHeight())
+
+	switcherComponent := components.CreateSwitcher("Switch channel")
+
+	browserComponent := components.CreateSwitcher("Join channel")
+
+	view := &View{
+		Input:        inputComponent,
+		Channels:     channelsComponent,
+		Chat:         chatComponent,
+		Mode:         modeComponent,
+		Thread:       threadComponent,
+		Switcher:     switcherComponent,
+		Browser:      browserComponent,
+		Body:         termui.Body,
+		sidebarWidth: config.SidebarWidth,
+		mainWidth:    config.MainWidth,
+	}
+
 	// Setup body
-	termui.Body.AddRows(
-		termui.NewRow(
-			termui.NewCol(config.SidebarWidth, 0, channelsComponent),
-			termui.NewCol(config.MainWidth, 0, chatComponent),
-		),
+	view.layout()
+	Render(termui.Body)
+
+	return view
+}
+
+// layout sets up the rows of the body, when a thread is open the Chat
+// pane shares its columns with the Thread pane. The panes above the Input
+// take the height that the Input leaves.
+func (v *View) layout() {
+	top := termui.NewRow(
+		termui.NewCol(v.sidebarWidth, 0, v.Channels),
+		termui.NewCol(v.mainWidth, 0, v.Chat),
+	)
+	if v.Thread.IsOpen() {
+		threadWidth := v.mainWidth / 2
+		top = termui.NewRow(
+			termui.NewCol(v.sidebarWidth, 0, v.Channels),
+			termui.NewCol(v.mainWidth-threadWidth, 0, v.Chat),
+			termui.NewCol(threadWidth, 0, v.Thread),
+		)
+	}
+
+	v.Body.Rows = nil
+	v.Body.AddRows(
+		top,
 		termui.NewRow(
-			termui.NewCol(config.SidebarWidth, 0, modeComponent),
-			termui.NewCol(config.MainWidth, 0, inputComponent),
+			termui.NewCol(v.sidebarWidth, 0, v.Mode),
+			termui.NewCol(v.mainWidth, 0, v.Input),
 		),
 	)
-	termui.Body.Align()
-	termui.Render(termui.Body)
 
-	view := &View{
-		Input:    inputComponent,
-		Channels: channelsComponent,
-		Chat:     chatComponent,
-		Mode:     modeComponent,
-		Body:     termui.Body,
+	// The height of the Input depends on its width, which is only known
+	// once the body is aligned
+	v.Body.Align()
+	v.inputHeight = v.Input.GetHeight()
+
+	height := termui.TermHeight() - v.inputHeight
+	v.Channels.SetHeight(height)
+	v.Chat.SetHeight(height)
+	v.Thread.SetHeight(height)
+	v.Body.Align()
+}
+
+// Resize lays out the body again for the current size of the terminal
+func (v *View) Resize() {
+	v.Body.Width = termui.TermWidth()
+	v.layout()
+	termui.Clear()
+	Render(v.Body)
+}
+
+// RenderInput renders the Input, the body is laid out again when the Input
+// has grown or shrunk
+func (v *View) RenderInput() {
+	if v.Input.GetHeight() != v.inputHeight {
+		v.layout()
+		termui.Clear()
+		Render(v.Body)
+		return
 	}
 
-	return view
+	Render(v.Input)
+}
+
+// SetWidths changes the number of columns of the sidebar and the main
+// pane, together they span the 12 columns of the grid
+func (v *View) SetWidths(sidebarWidth int, mainWidth int) {
+	v.sidebarWidth = sidebarWidth
+	v.mainWidth = mainWidth
+	v.layout()
+	termui.Clear()
+	Render(v.Body)
+}
+
+// OpenThread shows the Thread pane next to the Chat pane, messages
+// contains the parent message followed by the replies
+func (v *View) OpenThread(channelID string, threadTimestamp string, messages []service.Message) {
+	v.Thread.Open(channelID, threadTimestamp, messages)
+	v.layout()
+	termui.Clear()
+	Render(v.Body)
+}
+
+// CloseThread hides the Thread pane
+func (v *View) CloseThread() {
+	if !v.Thread.IsOpen() {
+		return
+	}
+
+	v.Thread.Close()
+	v.layout()
+	termui.Clear()
+	Render(v.Body)
+}
+
+// OpenSwitcher shows the Switcher on top of the other widgets, it matches
+// the channels of all teams. The channel in front is not ranked as
+// recently visited, so the previous channel is a keystroke away.
+func (v *View) OpenSwitcher() {
+	selected := v.Channels.GetSelectedChannelID()
+
+	var items []components.SwitcherItem
+	for _, channel := range v.Channels.GetChannels() {
+		item := components.SwitcherItem{
+			Channel: channel,
+			Unread:  v.Channels.IsUnread(channel.ID),
+		}
+		if channel.ID != selected {
+			item.LastVisit = v.Channels.GetLastVisit(channel.ID)
+		}
+		items = append(items, item)
+	}
+
+	v.Switcher.Open(items)
+	Render(v.Switcher)
+}
+
+// CloseSwitcher hides the Switcher
+func (v *View) CloseSwitcher() {
+	if !v.Switcher.IsOpen() {
+		return
+	}
+
+	v.Switcher.Close()
+	termui.Clear()
+	Render(v.Body)
+}
+
+// OpenBrowser shows the Browser on top of the other widgets, it matches
+// the channels that can be joined and lists their member count and topic
+func (v *View) OpenBrowser(channels service.Channels) {
+	sort.Sort(channels)
+
+	var items []components.SwitcherItem
+	for _, channel := range channels {
+		members := fmt.Sprintf("%d members", channel.MemberCount)
+		if channel.MemberCount == 1 {
+			members = "1 member"
+		}
+
+		detail := fmt.Sprintf("(%s)", members)
+		if channel.Topic != "" {
+			detail += " " + channel.Topic
+		}
+
+		items = append(items, components.SwitcherItem{
+			Channel: channel,
+			Detail:  detail,
+		})
+	}
+
+	v.Browser.Open(items)
+	Render(v.Browser)
+}
+
+// CloseBrowser hides the Browser
+func (v *View) CloseBrowser() {
+	if !v.Browser.IsOpen() {
+		return
+	}
+
+	v.Browser.Close()
+	termui.Clear()
+	Render(v.Body)
 }
 
 // Refresh renders all widgets on demand
 func (v *View) Refresh() {
-	termui.Render(
+	if v.Input.GetHeight() != v.inputHeight {
+		v.layout()
+		termui.Clear()
+	}
+
+	Render(
 		v.Input,
 		v.Chat,
 		v.Channels,
 		v.Mode,
 	)
+	if v.Thread.IsOpen() {
+		Render(v.Thread)
+	}
+	if v.Switcher.IsOpen() {
+		Render(v.Switcher)
+	}
+	if v.Browser.IsOpen() {
+		Render(v.Browser)
+	}
 }
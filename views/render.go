@@ -0,0 +1,28 @@
+package views
+
+import (
+	"github.com/gizak/termui"
+	termbox "github.com/nsf/termbox-go"
+)
+
+// Render draws the widgets to the terminal like termui.Render, only right
+// away instead of in the render goroutine of termui. So the widgets are
+// drawn before the caller changes them again, see AppContext.Lock.
+//
+// Nothing is drawn while the terminal is given back, see
+// AppContext.Suspend.
+func Render(bs ...termui.Bufferer) {
+	if !termbox.IsInit {
+		return
+	}
+
+	for _, b := range bs {
+		buf := b.Buffer()
+		for p, c := range buf.CellMap {
+			if p.In(buf.Area) {
+				termbox.SetCell(p.X, p.Y, c.Ch, termbox.Attribute(c.Fg), termbox.Attribute(c.Bg))
+			}
+		}
+	}
+	termbox.Flush()
+}